@@ -1,12 +1,23 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"expvar"
 	"net/http"
+	"os"
+	"os/signal"
 	"reflect"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/darkartx/go-project-278/handlers"
+	"github.com/darkartx/go-project-278/internal/geoip"
+	"github.com/darkartx/go-project-278/internal/privacy"
+	"github.com/darkartx/go-project-278/internal/recorder"
+	"github.com/darkartx/go-project-278/internal/retention"
 	"github.com/go-playground/validator/v10"
 
 	db "github.com/darkartx/go-project-278/db/generated"
@@ -18,14 +29,29 @@ import (
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
+const shutdownTimeout = 15 * time.Second
+
 type Config struct {
 	Debug       bool
 	DatabaseUrl string
 	Bind        string
+	Visits      recorder.Options
+	// Links kept by redirects, zero disables the cache
+	LinkCacheSize int
+	LinkCacheTTL  time.Duration
+	// Path to a MaxMind .mmdb database, visits aren't located without it
+	GeoipDatabase string
+	Privacy       privacy.Options
+	// Visits older than that are purged in the background, zero keeps them forever
+	VisitRetentionDays int
+	// Status of redirects for links without their own redirect type
+	RedirectType int
+	// Deleted links are purged after that, zero keeps them in the trash forever
+	LinkTrashDays int
 }
 
 func NewConfig(debug bool, databaseUrl string, bind string) *Config {
-	return &Config{debug, databaseUrl, bind}
+	return &Config{Debug: debug, DatabaseUrl: databaseUrl, Bind: bind}
 }
 
 func Api(config *Config) error {
@@ -47,22 +73,87 @@ func Api(config *Config) error {
 	}()
 
 	queries := db.New(database)
-	router := setupRouter(queries, config)
+
+	privacyPolicy, err := privacy.New(config.Privacy)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var geo *geoip.Database
+	if config.GeoipDatabase != "" {
+		if geo, err = geoip.Open(config.GeoipDatabase); err != nil {
+			return err
+		}
+
+		defer func() {
+			_ = geo.Close()
+		}()
+	}
+
+	linkCache := handlers.NewLinkCache(queries, config.LinkCacheSize, config.LinkCacheTTL)
+	if config.LinkCacheSize > 0 {
+		go linkCache.Listen(ctx, config.DatabaseUrl)
+	}
+
+	if config.VisitRetentionDays > 0 || config.LinkTrashDays > 0 {
+		go retention.Run(ctx, queries, retention.Options{Days: config.VisitRetentionDays, TrashDays: config.LinkTrashDays})
+	}
+
+	visitRecorder := recorder.NewBatch(recorder.CopyVisits(database), config.Visits)
+	expvar.Publish("visits", expvar.Func(func() any {
+		return visitRecorder.Stats()
+	}))
+
+	tracker := handlers.VisitTracker{Recorder: visitRecorder, Geo: geo, Privacy: privacyPolicy}
+
+	router := setupRouter(queries, linkCache, tracker, config)
 	router.TrustedPlatform = gin.PlatformCloudflare
 
 	if setupRollbar() {
 		router.Use(rollbar.Recovery(true))
 	}
 
-	return router.Run(config.Bind)
+	server := &http.Server{Addr: config.Bind, Handler: router}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err == nil {
+		err = server.Shutdown(shutdownCtx)
+	}
+
+	// Requests are done by now, write out the queued visits before the database is closed
+	if closeErr := visitRecorder.Close(shutdownCtx); closeErr != nil && err == nil {
+		err = closeErr
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
 }
 
-func setupRouter(queries *db.Queries, config *Config) *gin.Engine {
+func setupRouter(queries *db.Queries, linkCache *handlers.LinkCache, tracker handlers.VisitTracker, config *Config) *gin.Engine {
 	router := gin.Default()
 
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowOrigins = []string{"http://127.0.0.1:5173"}
 	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE"}
+	corsConfig.AddAllowHeaders("Api-Key", "Authorization")
 
 	router.Use(cors.New(corsConfig))
 
@@ -70,16 +161,26 @@ func setupRouter(queries *db.Queries, config *Config) *gin.Engine {
 		c.String(http.StatusOK, "pong")
 	})
 
-	api := router.Group("api")
+	api := router.Group("api", handlers.ApiKeyAuth(queries))
 	links := api.Group("links")
-	linksHandler := handlers.NewLinkHandler(queries)
+	linksHandler := handlers.NewLinkHandler(queries, linkCache)
 	linksHandler.Register(links)
 
 	linkVisits := api.Group("link_visits")
 	linkVisitsHandler := handlers.NewLinkVisitHandler(queries)
 	linkVisitsHandler.Register(linkVisits)
+	linkVisitsHandler.RegisterLink(links)
+
+	linkStatsHandler := handlers.NewLinkStatsHandler(queries)
+	linkStatsHandler.Register(links)
+
+	apiKeys := api.Group("api_keys")
+	apiKeysHandler := handlers.NewApiKeyHandler(queries)
+	apiKeysHandler.Register(apiKeys)
+
+	api.GET("metrics", handlers.RequireRole(handlers.RoleAdmin), gin.WrapH(expvar.Handler()))
 
-	redirectHandler := handlers.NewRedirectHandler(queries)
+	redirectHandler := handlers.NewRedirectHandler(queries, linkCache, tracker, config.RedirectType)
 	redirectHandler.Register(router)
 
 	return router
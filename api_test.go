@@ -10,17 +10,26 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	db "github.com/darkartx/go-project-278/db/generated"
 	"github.com/darkartx/go-project-278/handlers"
+	"github.com/darkartx/go-project-278/internal"
+	"github.com/darkartx/go-project-278/internal/geoip"
+	"github.com/darkartx/go-project-278/internal/privacy"
+	"github.com/darkartx/go-project-278/internal/recorder"
+	"github.com/darkartx/go-project-278/internal/retention"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/pressly/goose/v3"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var conn *sql.DB
@@ -39,9 +48,82 @@ func TestPingRoute(t *testing.T) {
 	assert.Equal(t, "pong", w.Body.String())
 }
 
+func TestApiWithoutApiKey(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+
+		for _, path := range []string{"/api/links", "/api/link_visits"} {
+			req, _ := http.NewRequest("GET", "http://localhost"+path, nil)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.JSONEq(t, `{"error":"unauthorized"}`, w.Body.String())
+		}
+	})
+}
+
+func TestApiWithInvalidApiKey(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+
+		req, _ := http.NewRequest("GET", "http://localhost/api/links", nil)
+		req.Header.Set("Api-Key", "invalid")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.JSONEq(t, `{"error":"unauthorized"}`, w.Body.String())
+	})
+}
+
+func TestApiWithBearerToken(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		req, _ := http.NewRequest("GET", "http://localhost/api/links", nil)
+		authorize(t, ctx, q, req, user)
+		req.Header.Set("Authorization", "Bearer "+req.Header.Get("Api-Key"))
+		req.Header.Del("Api-Key")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestApiWithRevokedApiKey(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		req, _ := http.NewRequest("GET", "http://localhost/api/links", nil)
+		authorize(t, ctx, q, req, user)
+
+		apiKey, err := q.GetActiveApiKeyByHash(ctx, internal.HashApiKey(req.Header.Get("Api-Key")))
+		if err != nil {
+			t.Fatalf("get api key: %v", err)
+		}
+
+		if _, err = q.RevokeApiKey(ctx, apiKey.ApiKey.ID); err != nil {
+			t.Fatalf("revoke api key: %v", err)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
 func TestLinksList(t *testing.T) {
 	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
 		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
 		var err error
 		var links [2]db.Link
@@ -50,6 +132,7 @@ func TestLinksList(t *testing.T) {
 			links[i], err = q.CreateLink(ctx, db.CreateLinkParams{
 				OriginalUrl: "https://google.com",
 				ShortName:   fmt.Sprintf("test%d", i),
+				OwnerID:     user.ID,
 			})
 
 			if err != nil {
@@ -58,6 +141,7 @@ func TestLinksList(t *testing.T) {
 		}
 
 		req, _ := http.NewRequest("GET", "http://localhost/api/links", nil)
+		authorize(t, ctx, q, req, user)
 
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
@@ -66,8 +150,8 @@ func TestLinksList(t *testing.T) {
 		assert.Equal(t, "links 0-9/2", w.Header().Get("Content-Range"))
 
 		expectedLinks := []handlers.Link{
-			{Id: uint64(links[0].ID), OriginalUrl: "https://google.com", ShortName: "test0", ShortUrl: "http://localhost/r/test0"},
-			{Id: uint64(links[1].ID), OriginalUrl: "https://google.com", ShortName: "test1", ShortUrl: "http://localhost/r/test1"},
+			{Id: uint64(links[0].ID), OriginalUrl: "https://google.com", ShortName: "test0", ShortUrl: "http://localhost/r/test0", OwnerId: uint64(user.ID)},
+			{Id: uint64(links[1].ID), OriginalUrl: "https://google.com", ShortName: "test1", ShortUrl: "http://localhost/r/test1", OwnerId: uint64(user.ID)},
 		}
 		var actualLinks []handlers.Link
 		err = json.Unmarshal(w.Body.Bytes(), &actualLinks)
@@ -79,6 +163,7 @@ func TestLinksList(t *testing.T) {
 func TestLinksListWithPagination(t *testing.T) {
 	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
 		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
 		var err error
 		var links [20]db.Link
@@ -87,6 +172,7 @@ func TestLinksListWithPagination(t *testing.T) {
 			links[i], err = q.CreateLink(ctx, db.CreateLinkParams{
 				OriginalUrl: "https://google.com",
 				ShortName:   fmt.Sprintf("test%d", i),
+				OwnerID:     user.ID,
 			})
 
 			if err != nil {
@@ -95,6 +181,7 @@ func TestLinksListWithPagination(t *testing.T) {
 		}
 
 		req, _ := http.NewRequest("GET", "http://localhost/api/links?range=[5,10]", nil)
+		authorize(t, ctx, q, req, user)
 
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
@@ -112,6 +199,7 @@ func TestLinksListWithPagination(t *testing.T) {
 					OriginalUrl: "https://google.com",
 					ShortName:   link.ShortName,
 					ShortUrl:    fmt.Sprintf("http://localhost/r/%s", link.ShortName),
+					OwnerId:     uint64(user.ID),
 				},
 			)
 		}
@@ -126,6 +214,7 @@ func TestLinksListWithPagination(t *testing.T) {
 func TestLinksListWithInvalidPagination(t *testing.T) {
 	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
 		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
 		var err error
 		var links [2]db.Link
@@ -134,6 +223,7 @@ func TestLinksListWithInvalidPagination(t *testing.T) {
 			links[i], err = q.CreateLink(ctx, db.CreateLinkParams{
 				OriginalUrl: "https://google.com",
 				ShortName:   fmt.Sprintf("test%d", i),
+				OwnerID:     user.ID,
 			})
 
 			if err != nil {
@@ -150,6 +240,7 @@ func TestLinksListWithInvalidPagination(t *testing.T) {
 
 		for _, caseItem := range cases {
 			req, _ := http.NewRequest("GET", fmt.Sprintf("http://localhost/api/links?range=%s", caseItem), nil)
+			authorize(t, ctx, q, req, user)
 
 			w := httptest.NewRecorder()
 			router.ServeHTTP(w, req)
@@ -165,9 +256,11 @@ func TestLinksListWithInvalidPagination(t *testing.T) {
 func TestLinksCreate(t *testing.T) {
 	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
 		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
 		body := `{"original_url":"https://google.com","short_name":"testtest"}`
 		req, _ := http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
 
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
@@ -195,12 +288,78 @@ func TestLinksCreate(t *testing.T) {
 	})
 }
 
+func TestLinksCreateWithExpiration(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		body := `{"original_url":"https://google.com","short_name":"testtest","expires_at":"2030-01-02T15:04:05Z","expired_url":"https://google.com/expired"}`
+		req, _ := http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var actualLink handlers.Link
+		err := json.Unmarshal(w.Body.Bytes(), &actualLink)
+		assert.NoError(t, err)
+
+		createdLink, err := q.GetLink(ctx, int64(actualLink.Id))
+		if err != nil {
+			t.Fatalf("get link: %v", err)
+		}
+
+		expiresAt := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+
+		assert.True(t, createdLink.ExpiresAt.Valid)
+		assert.True(t, expiresAt.Equal(createdLink.ExpiresAt.Time))
+		assert.Equal(t, "https://google.com/expired", createdLink.ExpiredUrl.String)
+		if assert.NotNil(t, actualLink.ExpiresAt) {
+			assert.True(t, expiresAt.Equal(*actualLink.ExpiresAt))
+		}
+		assert.Equal(t, "https://google.com/expired", actualLink.ExpiredUrl)
+	})
+}
+
+func TestLinksCreateWithPassword(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		body := `{"original_url":"https://google.com","short_name":"testtest","password":"secret"}`
+		req, _ := http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var actualLink handlers.Link
+		err := json.Unmarshal(w.Body.Bytes(), &actualLink)
+		assert.NoError(t, err)
+		assert.True(t, actualLink.HasPassword)
+		assert.NotContains(t, w.Body.String(), "secret")
+
+		createdLink, err := q.GetLink(ctx, int64(actualLink.Id))
+		if err != nil {
+			t.Fatalf("get link: %v", err)
+		}
+
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(createdLink.PasswordHash.String), []byte("secret")))
+	})
+}
+
 func TestLinksCreateWithoutShortName(t *testing.T) {
 	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
 		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
 		body := `{"original_url":"https://google.com"}`
 		req, _ := http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
 
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
@@ -226,12 +385,77 @@ func TestLinksCreateWithoutShortName(t *testing.T) {
 	})
 }
 
+func TestLinksCreateWithRedirectType(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		body := `{"original_url":"https://google.com","short_name":"testtest","redirect_type":301}`
+		req, _ := http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var actualLink handlers.Link
+		err := json.Unmarshal(w.Body.Bytes(), &actualLink)
+		assert.NoError(t, err)
+		assert.Equal(t, int16(301), *actualLink.RedirectType)
+
+		body = `{"original_url":"https://google.com","short_name":"testtest2","redirect_type":303}`
+		req, _ = http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+		expected := `{"errors":{"RedirectType":"Key: 'LinkParams.RedirectType' Error:Field validation for 'RedirectType' failed on the 'oneof' tag"}}`
+		assert.JSONEq(t, expected, w.Body.String())
+	})
+}
+
+func TestLinksCreateWithUtm(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		body := `{"original_url":"https://example.com/?utm_source=old&lang=en","short_name":"testtest","utm":{"source":"newsletter","medium":"email","campaign":"spring sale"}}`
+		req, _ := http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var actualLink handlers.Link
+		err := json.Unmarshal(w.Body.Bytes(), &actualLink)
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/?utm_source=old&lang=en", actualLink.OriginalUrl)
+		assert.Equal(t, &handlers.LinkUtm{Source: "newsletter", Medium: "email", Campaign: "spring sale"}, actualLink.Utm)
+
+		req, _ = http.NewRequest("GET", "http://localhost/r/testtest", nil)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com/?lang=en&utm_campaign=spring+sale&utm_medium=email&utm_source=newsletter", w.Header().Get("Location"))
+	})
+}
+
 func TestLinksCreateWithInvalidOriginalUrl(t *testing.T) {
 	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
 		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
 		body := `{"original_url":"invalid-url","short_name":"testtest"}`
 		req, _ := http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
 
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
@@ -263,13 +487,15 @@ func TestLinksCreateWithInvalidOriginalUrl(t *testing.T) {
 func TestLinksCreateWithUsedShortName(t *testing.T) {
 	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
 		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
-		if _, err := q.CreateLink(ctx, db.CreateLinkParams{OriginalUrl: "https://google.com", ShortName: "testtest"}); err != nil {
+		if _, err := q.CreateLink(ctx, db.CreateLinkParams{OriginalUrl: "https://google.com", ShortName: "testtest", OwnerID: user.ID}); err != nil {
 			t.Fatalf("create link: %v", err)
 		}
 
 		body := `{"original_url":"https://google.com","short_name":"testtest"}`
 		req, _ := http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
 
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
@@ -284,13 +510,15 @@ func TestLinksCreateWithUsedShortName(t *testing.T) {
 func TestLinksGet(t *testing.T) {
 	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
 		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
-		link, err := q.CreateLink(ctx, db.CreateLinkParams{OriginalUrl: "https://google.com", ShortName: "testtest"})
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{OriginalUrl: "https://google.com", ShortName: "testtest", OwnerID: user.ID})
 		if err != nil {
 			t.Fatalf("create link: %v", err)
 		}
 
 		req, _ := http.NewRequest("GET", fmt.Sprint("http://localhost/api/links/", link.ID), nil)
+		authorize(t, ctx, q, req, user)
 
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
@@ -309,44 +537,54 @@ func TestLinksGet(t *testing.T) {
 }
 
 func TestLinksGetWithNotExistingId(t *testing.T) {
-	router := setupTestRouter()
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
-	req, _ := http.NewRequest("GET", "http://localhost/api/links/1", nil)
+		req, _ := http.NewRequest("GET", "http://localhost/api/links/1", nil)
+		authorize(t, ctx, q, req, user)
 
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, http.StatusNotFound, w.Code)
 
-	expected := `{"error":"Not found"}`
-	assert.JSONEq(t, expected, w.Body.String())
+		expected := `{"error":"Not found"}`
+		assert.JSONEq(t, expected, w.Body.String())
+	})
 }
 
 func TestLinksGetWithInvalidId(t *testing.T) {
-	router := setupTestRouter()
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
-	req, _ := http.NewRequest("GET", "http://localhost/api/links/abc", nil)
+		req, _ := http.NewRequest("GET", "http://localhost/api/links/abc", nil)
+		authorize(t, ctx, q, req, user)
 
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
 
-	expected := `{"error":"invalid id"}`
-	assert.JSONEq(t, expected, w.Body.String())
+		expected := `{"error":"invalid id"}`
+		assert.JSONEq(t, expected, w.Body.String())
+	})
 }
 
 func TestLinksUpdate(t *testing.T) {
 	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
 		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
-		link, err := q.CreateLink(ctx, db.CreateLinkParams{OriginalUrl: "http://localhost/", ShortName: "123ABC"})
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{OriginalUrl: "http://localhost/", ShortName: "123ABC", OwnerID: user.ID})
 		if err != nil {
 			t.Fatalf("create link: %v", err)
 		}
 
 		body := `{"original_url":"https://google.com","short_name":"testtest"}`
 		req, _ := http.NewRequest("PUT", fmt.Sprint("http://localhost/api/links/", link.ID), bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
 
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
@@ -371,32 +609,79 @@ func TestLinksUpdate(t *testing.T) {
 	})
 }
 
+func TestLinksUpdateWithMaxVisits(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{OriginalUrl: "http://localhost/", ShortName: "123ABC", OwnerID: user.ID})
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		// Redirects made before the limit count against it, failed ones and bots don't
+		for _, visit := range []db.CreateVisitParams{
+			{LinkID: link.ID, Status: http.StatusFound},
+			{LinkID: link.ID, Status: http.StatusFound},
+			{LinkID: link.ID, Status: http.StatusGone},
+			{LinkID: link.ID, Status: http.StatusFound, ClientType: sql.NullString{String: "bot", Valid: true}},
+		} {
+			if _, err = q.CreateVisit(ctx, visit); err != nil {
+				t.Fatalf("create link visit: %v", err)
+			}
+		}
+
+		body := `{"original_url":"https://google.com","short_name":"testtest","max_visits":3}`
+		req, _ := http.NewRequest("PUT", fmt.Sprint("http://localhost/api/links/", link.ID), bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var actualLink handlers.Link
+		err = json.Unmarshal(w.Body.Bytes(), &actualLink)
+		assert.NoError(t, err)
+
+		if assert.NotNil(t, actualLink.RemainingVisits) {
+			assert.Equal(t, int32(1), *actualLink.RemainingVisits)
+		}
+	})
+}
+
 func TestLinksUpdateWithInvalidId(t *testing.T) {
-	router := setupTestRouter()
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
-	body := `{"original_url":"http://google.com","short_name":"testtest"}`
-	req, _ := http.NewRequest("PUT", "http://localhost/api/links/abc", bytes.NewBufferString(body))
+		body := `{"original_url":"http://google.com","short_name":"testtest"}`
+		req, _ := http.NewRequest("PUT", "http://localhost/api/links/abc", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
 
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
 
-	expected := `{"error":"invalid id"}`
-	assert.JSONEq(t, expected, w.Body.String())
+		expected := `{"error":"invalid id"}`
+		assert.JSONEq(t, expected, w.Body.String())
+	})
 }
 
 func TestLinksUpdateWithInvalidOriginalUrl(t *testing.T) {
 	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
 		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
-		link, err := q.CreateLink(ctx, db.CreateLinkParams{OriginalUrl: "http://localhost/", ShortName: "123ABC"})
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{OriginalUrl: "http://localhost/", ShortName: "123ABC", OwnerID: user.ID})
 		if err != nil {
 			t.Fatalf("create link: %v", err)
 		}
 
 		body := `{"original_url":"invalid-url","short_name":"testtest"}`
 		req, _ := http.NewRequest("PUT", fmt.Sprintf("http://localhost/api/links/%d", link.ID), bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
 
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
@@ -431,25 +716,30 @@ func TestLinksUpdateWithInvalidOriginalUrl(t *testing.T) {
 // }
 
 func TestLinksUpdateWithNotExistingId(t *testing.T) {
-	router := setupTestRouter()
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
-	body := `{"original_url":"https://google.com","short_name":"testtest"}`
-	req, _ := http.NewRequest("PUT", "http://localhost/api/links/1", bytes.NewBufferString(body))
+		body := `{"original_url":"https://google.com","short_name":"testtest"}`
+		req, _ := http.NewRequest("PUT", "http://localhost/api/links/1", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
 
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, http.StatusNotFound, w.Code)
 
-	expected := `{"error":"Not found"}`
-	assert.JSONEq(t, expected, w.Body.String())
+		expected := `{"error":"Not found"}`
+		assert.JSONEq(t, expected, w.Body.String())
+	})
 }
 
 func TestLinksDelete(t *testing.T) {
 	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
 		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
-		link, err := q.CreateLink(ctx, db.CreateLinkParams{OriginalUrl: "http://localhost/", ShortName: "123ABC"})
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{OriginalUrl: "http://localhost/", ShortName: "123ABC", OwnerID: user.ID})
 		if err != nil {
 			t.Fatalf("create link: %v", err)
 		}
@@ -466,6 +756,7 @@ func TestLinksDelete(t *testing.T) {
 		}
 
 		req, _ := http.NewRequest("DELETE", fmt.Sprint("http://localhost/api/links/", link.ID), nil)
+		authorize(t, ctx, q, req, user)
 
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
@@ -473,232 +764,2257 @@ func TestLinksDelete(t *testing.T) {
 		assert.Equal(t, http.StatusNoContent, w.Code)
 		assert.Equal(t, "", w.Body.String())
 
-		_, err = q.GetLink(ctx, link.ID)
+		// Moved to the trash with its visits
+		link, err = q.GetLink(ctx, link.ID)
+		assert.NoError(t, err)
+		assert.True(t, link.DeletedAt.Valid)
+
+		count, err := q.GetVisitCount(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		_, err = q.GetOwnedLink(ctx, db.GetOwnedLinkParams{ID: link.ID, OwnerID: link.OwnerID})
 		assert.ErrorIs(t, err, sql.ErrNoRows)
 	})
 }
 
-func TestLinksDeleteWithInvalidId(t *testing.T) {
-	router := setupTestRouter()
-
-	req, _ := http.NewRequest("DELETE", "http://localhost/api/links/abc", nil)
+func TestLinksTrashAndRestore(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
+		links := make([]db.Link, 0, 2)
+		for _, shortName := range []string{"ABC123", "ABC124"} {
+			link, err := q.CreateLink(ctx, db.CreateLinkParams{OriginalUrl: "https://google.com", ShortName: shortName, OwnerID: user.ID})
+			if err != nil {
+				t.Fatalf("create link: %v", err)
+			}
 
-	assert.Equal(t, http.StatusBadRequest, w.Code)
+			links = append(links, link)
+		}
 
-	expected := `{"error":"invalid id"}`
-	assert.JSONEq(t, expected, w.Body.String())
-}
+		send := func(method string, url string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, url, nil)
+			authorize(t, ctx, q, req, user)
 
-func TestLinksDeleteWithNotExistingId(t *testing.T) {
-	router := setupTestRouter()
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
 
-	req, _ := http.NewRequest("DELETE", "http://localhost/api/links/1", nil)
+			return w
+		}
 
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
+		w := send("DELETE", fmt.Sprint("http://localhost/api/links/", links[0].ID))
+		assert.Equal(t, http.StatusNoContent, w.Code)
 
-	assert.Equal(t, http.StatusNotFound, w.Code)
+		w = send("GET", "http://localhost/api/links")
+		assert.Equal(t, "links 0-9/1", w.Header().Get("Content-Range"))
 
-	expected := `{"error":"Not found"}`
-	assert.JSONEq(t, expected, w.Body.String())
-}
+		w = send("GET", "http://localhost/api/links?trashed=true")
+		assert.Equal(t, "links 0-9/1", w.Header().Get("Content-Range"))
 
-func TestLinkVisitsList(t *testing.T) {
-	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
-		router := setupTestRouterWithQueries(q)
+		var actualLinks []handlers.Link
+		err := json.Unmarshal(w.Body.Bytes(), &actualLinks)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(links[0].ID), actualLinks[0].Id)
+		assert.NotNil(t, actualLinks[0].DeletedAt)
 
-		var err error
-		var visits [2]db.Visit
-		link, err := q.CreateLink(ctx, db.CreateLinkParams{
-			OriginalUrl: "https://google.com",
-			ShortName:   "ABC123",
-		})
+		w = send("GET", "http://localhost/api/links?trashed=maybe")
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.JSONEq(t, `{"errors":{"trashed":"invalid boolean"}}`, w.Body.String())
 
-		if err != nil {
-			t.Fatalf("create link: %v", err)
+		for _, path := range []string{"", "/stats", "/visits"} {
+			w = send("GET", fmt.Sprintf("http://localhost/api/links/%d%s", links[0].ID, path))
+			assert.Equal(t, http.StatusNotFound, w.Code, path)
 		}
 
-		for i := 0; i < 2; i++ {
-			visits[i], err = q.CreateVisit(ctx, db.CreateVisitParams{
-				LinkID:    link.ID,
-				Ip:        sql.NullString{String: "10.0.0.1", Valid: true},
-				UserAgent: sql.NullString{String: "UserAgent", Valid: true},
-				Referer:   sql.NullString{String: "http://localhost/", Valid: true},
-				Status:    302,
+		req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusGone, w.Code)
+		assert.JSONEq(t, `{"error":"link deleted"}`, w.Body.String())
+
+		w = send("POST", fmt.Sprintf("http://localhost/api/links/%d/restore", links[0].ID))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var actualLink handlers.Link
+		err = json.Unmarshal(w.Body.Bytes(), &actualLink)
+		assert.NoError(t, err)
+		assert.Nil(t, actualLink.DeletedAt)
+
+		// Only trashed links are restored
+		w = send("POST", fmt.Sprintf("http://localhost/api/links/%d/restore", links[0].ID))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		req, _ = http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+
+		// Purged once trashed for long enough
+		w = send("DELETE", fmt.Sprint("http://localhost/api/links/", links[1].ID))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		if _, err = tx.ExecContext(ctx, "UPDATE links SET deleted_at = $1 WHERE id = $2", time.Now().AddDate(0, 0, -40), links[1].ID); err != nil {
+			t.Fatalf("update link: %v", err)
+		}
+
+		deleted, err := retention.PurgeLinks(ctx, q, retention.Cutoff(time.Now(), 30), 0)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+
+		_, err = q.GetLink(ctx, links[1].ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		_, err = q.GetLink(ctx, links[0].ID)
+		assert.NoError(t, err)
+	})
+}
+
+func TestLinksDeleteWithInvalidId(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		req, _ := http.NewRequest("DELETE", "http://localhost/api/links/abc", nil)
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		expected := `{"error":"invalid id"}`
+		assert.JSONEq(t, expected, w.Body.String())
+	})
+}
+
+func TestLinksDeleteWithNotExistingId(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		req, _ := http.NewRequest("DELETE", "http://localhost/api/links/1", nil)
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		expected := `{"error":"Not found"}`
+		assert.JSONEq(t, expected, w.Body.String())
+	})
+}
+
+func TestLinksOfOtherUser(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		owner := createUser(t, ctx, q)
+
+		workspace, err := q.GetWorkspace(ctx, owner.WorkspaceID)
+		if err != nil {
+			t.Fatalf("get workspace: %v", err)
+		}
+
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "other1",
+			OwnerID:     owner.ID,
+		})
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		linkUrl := fmt.Sprint("http://localhost/api/links/", link.ID)
+
+		// Members see every link of the workspace, editors only change their own, admins delete any
+		cases := []struct {
+			role, method, url, body string
+			code                    int
+		}{
+			{handlers.RoleViewer, "GET", "http://localhost/api/links", "", http.StatusOK},
+			{handlers.RoleViewer, "GET", linkUrl, "", http.StatusOK},
+			{handlers.RoleEditor, "PUT", linkUrl, `{"original_url":"https://google.com/changed","short_name":"other1"}`, http.StatusNotFound},
+			{handlers.RoleAdmin, "DELETE", linkUrl, "", http.StatusNoContent},
+			{handlers.RoleAdmin, "POST", linkUrl + "/restore", "", http.StatusOK},
+		}
+
+		for _, caseItem := range cases {
+			user := createWorkspaceUser(t, ctx, q, workspace, caseItem.role)
+
+			req, _ := http.NewRequest(caseItem.method, caseItem.url, bytes.NewBufferString(caseItem.body))
+			authorize(t, ctx, q, req, user)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, caseItem.code, w.Code, "%s %s %s", caseItem.role, caseItem.method, caseItem.url)
+
+			if caseItem.url == "http://localhost/api/links" {
+				assert.Equal(t, "links 0-9/1", w.Header().Get("Content-Range"))
+			}
+		}
+
+		link, err = q.GetLink(ctx, link.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "https://google.com", link.OriginalUrl)
+		assert.False(t, link.DeletedAt.Valid)
+	})
+}
+
+func TestLinkVisitsListOfOtherUser(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+		otherUser := createUser(t, ctx, q)
+
+		workspace, err := q.GetWorkspace(ctx, user.WorkspaceID)
+		if err != nil {
+			t.Fatalf("get workspace: %v", err)
+		}
+
+		var otherLink db.Link
+		for i, owner := range []db.User{user, otherUser} {
+			otherLink, err = q.CreateLink(ctx, db.CreateLinkParams{
+				OriginalUrl: "https://google.com",
+				ShortName:   fmt.Sprintf("test%d", i),
+				OwnerID:     owner.ID,
+			})
+			if err != nil {
+				t.Fatalf("create link: %v", err)
+			}
+
+			_, err = q.CreateVisit(ctx, db.CreateVisitParams{LinkID: otherLink.ID, Status: http.StatusFound})
+			if err != nil {
+				t.Fatalf("create link visit: %v", err)
+			}
+		}
+
+		// A viewer owns no links and still sees the visits of the workspace
+		viewer := createWorkspaceUser(t, ctx, q, workspace, handlers.RoleViewer)
+
+		cases := []struct {
+			url, contentRange string
+		}{
+			{"http://localhost/api/link_visits", "visits 0-9/2"},
+			{fmt.Sprintf("http://localhost/api/links/%d/visits", otherLink.ID), "visits 0-9/1"},
+		}
+
+		for _, caseItem := range cases {
+			req, _ := http.NewRequest("GET", caseItem.url, nil)
+			authorize(t, ctx, q, req, viewer)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, caseItem.contentRange, w.Header().Get("Content-Range"))
+		}
+	})
+}
+
+func TestLinksOfOtherWorkspace(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+		otherUser := createOtherWorkspaceUser(t, ctx, q)
+
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "other1",
+			OwnerID:     otherUser.ID,
+		})
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost/api/links", nil)
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "links 0-9/0", w.Header().Get("Content-Range"))
+		assert.JSONEq(t, `[]`, w.Body.String())
+
+		cases := []struct {
+			method string
+			body   string
+		}{
+			{"GET", ""},
+			{"PUT", `{"original_url":"https://google.com/changed","short_name":"other1"}`},
+			{"DELETE", ""},
+		}
+
+		for _, caseItem := range cases {
+			req, _ := http.NewRequest(caseItem.method, fmt.Sprint("http://localhost/api/links/", link.ID), bytes.NewBufferString(caseItem.body))
+			authorize(t, ctx, q, req, user)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		}
+
+		link, err = q.GetLink(ctx, link.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "https://google.com", link.OriginalUrl)
+	})
+}
+
+func TestLinkVisitsListOfOtherWorkspace(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+		otherUser := createOtherWorkspaceUser(t, ctx, q)
+
+		for i, owner := range []db.User{user, otherUser} {
+			link, err := q.CreateLink(ctx, db.CreateLinkParams{
+				OriginalUrl: "https://google.com",
+				ShortName:   fmt.Sprintf("test%d", i),
+				OwnerID:     owner.ID,
+			})
+			if err != nil {
+				t.Fatalf("create link: %v", err)
+			}
+
+			_, err = q.CreateVisit(ctx, db.CreateVisitParams{LinkID: link.ID, Status: http.StatusFound})
+			if err != nil {
+				t.Fatalf("create link visit: %v", err)
+			}
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost/api/link_visits", nil)
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "visits 0-9/1", w.Header().Get("Content-Range"))
+	})
+}
+
+func TestLinksCreateWithExceededWorkspaceQuota(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+
+		workspace, err := q.CreateWorkspace(ctx, db.CreateWorkspaceParams{
+			Name:     "marketing",
+			Domain:   sql.NullString{String: "go.example.com", Valid: true},
+			MaxLinks: sql.NullInt32{Int32: 1, Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("create workspace: %v", err)
+		}
+
+		user := createWorkspaceUser(t, ctx, q, workspace, handlers.RoleAdmin)
+
+		for _, code := range []int{http.StatusCreated, http.StatusForbidden} {
+			body := `{"original_url":"https://google.com"}`
+			req, _ := http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+			authorize(t, ctx, q, req, user)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, code, w.Code)
+
+			if code == http.StatusCreated {
+				var actualLink handlers.Link
+				err = json.Unmarshal(w.Body.Bytes(), &actualLink)
+				assert.NoError(t, err)
+				assert.Equal(t, "http://go.example.com/r/"+actualLink.ShortName, actualLink.ShortUrl)
+			} else {
+				assert.JSONEq(t, `{"error":"workspace link quota exceeded"}`, w.Body.String())
+			}
+		}
+
+		// Trashed links don't count, restoring one counts it again
+		links, err := q.ListLinks(ctx, db.ListLinksParams{WorkspaceID: user.WorkspaceID, Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, links, 1)
+
+		err = q.TrashLink(ctx, db.TrashLinkParams{ID: links[0].ID, WorkspaceID: user.WorkspaceID})
+		assert.NoError(t, err)
+
+		cases := []struct {
+			method, url string
+			code        int
+		}{
+			{"POST", "http://localhost/api/links", http.StatusCreated},
+			{"POST", fmt.Sprintf("http://localhost/api/links/%d/restore", links[0].ID), http.StatusForbidden},
+		}
+
+		for _, caseItem := range cases {
+			req, _ := http.NewRequest(caseItem.method, caseItem.url, bytes.NewBufferString(`{"original_url":"https://google.com"}`))
+			authorize(t, ctx, q, req, user)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, caseItem.code, w.Code, caseItem.url)
+		}
+	})
+}
+
+func TestRedirectWithWorkspaceDomain(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		workspace, err := q.CreateWorkspace(ctx, db.CreateWorkspaceParams{
+			Name:   "marketing",
+			Domain: sql.NullString{String: "go.example.com", Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("create workspace: %v", err)
+		}
+
+		workspaceUser := createWorkspaceUser(t, ctx, q, workspace, handlers.RoleAdmin)
+
+		for _, owner := range []db.User{user, workspaceUser} {
+			_, err = q.CreateLink(ctx, db.CreateLinkParams{
+				OriginalUrl: fmt.Sprintf("https://google.com/%d", owner.WorkspaceID),
+				ShortName:   "ABC123",
+				OwnerID:     owner.ID,
+			})
+			if err != nil {
+				t.Fatalf("create link: %v", err)
+			}
+		}
+
+		cases := map[string]db.User{
+			"http://localhost/r/ABC123":           user,
+			"http://go.example.com/r/ABC123":      workspaceUser,
+			"http://GO.example.com:8080/r/ABC123": workspaceUser,
+		}
+
+		for address, owner := range cases {
+			req, _ := http.NewRequest("GET", address, nil)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusFound, w.Code)
+			assert.Equal(t, fmt.Sprintf("https://google.com/%d", owner.WorkspaceID), w.Header().Get("Location"))
+		}
+	})
+}
+
+func TestLinksRoles(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		owner := createUser(t, ctx, q)
+
+		workspace, err := q.GetWorkspace(ctx, owner.WorkspaceID)
+		if err != nil {
+			t.Fatalf("get workspace: %v", err)
+		}
+
+		linkUrl := "http://localhost/api/links/:id"
+		body := `{"original_url":"https://google.com","short_name":"ABC123"}`
+
+		cases := []struct {
+			role, method, url, body string
+			code                    int
+		}{
+			{handlers.RoleViewer, "GET", "http://localhost/api/links", "", http.StatusOK},
+			{handlers.RoleViewer, "GET", linkUrl, "", http.StatusOK},
+			{handlers.RoleViewer, "GET", "http://localhost/api/link_visits", "", http.StatusOK},
+			{handlers.RoleViewer, "POST", "http://localhost/api/links", body, http.StatusForbidden},
+			{handlers.RoleViewer, "PUT", linkUrl, body, http.StatusForbidden},
+			{handlers.RoleViewer, "DELETE", linkUrl, "", http.StatusForbidden},
+			{handlers.RoleViewer, "GET", "http://localhost/api/api_keys", "", http.StatusForbidden},
+			{handlers.RoleEditor, "PUT", linkUrl, body, http.StatusOK},
+			{handlers.RoleEditor, "DELETE", linkUrl, "", http.StatusForbidden},
+			{handlers.RoleEditor, "GET", "http://localhost/api/api_keys", "", http.StatusForbidden},
+			{handlers.RoleEditor, "GET", "http://localhost/api/metrics", "", http.StatusForbidden},
+			{handlers.RoleAdmin, "GET", "http://localhost/api/api_keys", "", http.StatusOK},
+			{handlers.RoleAdmin, "GET", "http://localhost/api/metrics", "", http.StatusOK},
+			{handlers.RoleAdmin, "DELETE", linkUrl, "", http.StatusNoContent},
+		}
+
+		for _, caseItem := range cases {
+			user := createWorkspaceUser(t, ctx, q, workspace, caseItem.role)
+
+			// Roles apply on top of ownership, every user works on a link of their own
+			link, err := q.CreateLink(ctx, db.CreateLinkParams{
+				OriginalUrl: "https://google.com",
+				ShortName:   fmt.Sprintf("ABC%d", user.ID),
+				OwnerID:     user.ID,
+			})
+			if err != nil {
+				t.Fatalf("create link: %v", err)
+			}
+
+			address := strings.Replace(caseItem.url, ":id", fmt.Sprint(link.ID), 1)
+			req, _ := http.NewRequest(caseItem.method, address, bytes.NewBufferString(caseItem.body))
+			authorize(t, ctx, q, req, user)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, caseItem.code, w.Code, "%s %s %s", caseItem.role, caseItem.method, caseItem.url)
+
+			if caseItem.code == http.StatusForbidden {
+				assert.JSONEq(t, `{"error":"forbidden"}`, w.Body.String())
+			}
+		}
+	})
+}
+
+func TestApiKeysCreateAndRevoke(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		admin := createUser(t, ctx, q)
+
+		workspace, err := q.GetWorkspace(ctx, admin.WorkspaceID)
+		if err != nil {
+			t.Fatalf("get workspace: %v", err)
+		}
+
+		viewer := createWorkspaceUser(t, ctx, q, workspace, handlers.RoleViewer)
+
+		body := fmt.Sprintf(`{"name":"dashboard","user_id":%d}`, viewer.ID)
+		req, _ := http.NewRequest("POST", "http://localhost/api/api_keys", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, admin)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var apiKey handlers.ApiKey
+		err = json.Unmarshal(w.Body.Bytes(), &apiKey)
+		assert.NoError(t, err)
+		assert.Equal(t, "dashboard", apiKey.Name)
+		assert.Equal(t, uint64(viewer.ID), apiKey.UserId)
+		assert.NotEmpty(t, apiKey.Key)
+
+		req, _ = http.NewRequest("GET", "http://localhost/api/links", nil)
+		req.Header.Set("Api-Key", apiKey.Key)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		req, _ = http.NewRequest("DELETE", fmt.Sprint("http://localhost/api/api_keys/", apiKey.Id), nil)
+		authorize(t, ctx, q, req, admin)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		req, _ = http.NewRequest("GET", "http://localhost/api/links", nil)
+		req.Header.Set("Api-Key", apiKey.Key)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestApiKeysCreateForOtherWorkspaceUser(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		admin := createUser(t, ctx, q)
+		otherUser := createOtherWorkspaceUser(t, ctx, q)
+
+		body := fmt.Sprintf(`{"name":"dashboard","user_id":%d}`, otherUser.ID)
+		req, _ := http.NewRequest("POST", "http://localhost/api/api_keys", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, admin)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestLinkVisitsList(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		var err error
+		var visits [2]db.Visit
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			visits[i], err = q.CreateVisit(ctx, db.CreateVisitParams{
+				LinkID:    link.ID,
+				Ip:        sql.NullString{String: "10.0.0.1", Valid: true},
+				UserAgent: sql.NullString{String: "UserAgent", Valid: true},
+				Referer:   sql.NullString{String: "http://localhost/", Valid: true},
+				Status:    302,
+			})
+
+			if err != nil {
+				t.Fatalf("create link visit: %v", err)
+			}
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost/api/link_visits", nil)
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "visits 0-9/2", w.Header().Get("Content-Range"))
+
+		var actualVisits []handlers.Visit
+		err = json.Unmarshal(w.Body.Bytes(), &actualVisits)
+		assert.NoError(t, err)
+
+		for i, visit := range actualVisits {
+			assert.Equal(t, visits[i].ID, int64(visit.Id))
+			assert.Equal(t, visits[i].LinkID, int64(visit.LinkId))
+			assert.Equal(t, visits[i].Ip.String, visit.Ip)
+			assert.Equal(t, visits[i].UserAgent.String, visit.UserAgent)
+			assert.Equal(t, visits[i].Status, int16(visit.Status))
+			assert.Equal(t, visits[i].Referer.String, visit.Referer)
+		}
+	})
+}
+
+func TestLinkVistsListWithPagination(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		var err error
+		var visits [20]db.Visit
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		for i := 0; i < 20; i++ {
+			visits[i], err = q.CreateVisit(ctx, db.CreateVisitParams{
+				LinkID:    link.ID,
+				Ip:        sql.NullString{String: "10.0.0.1", Valid: true},
+				UserAgent: sql.NullString{String: "UserAgent", Valid: true},
+				Referer:   sql.NullString{String: "http://localhost/", Valid: true},
+				Status:    302,
+			})
+
+			if err != nil {
+				t.Fatalf("create link visit: %v", err)
+			}
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost/api/link_visits?range=[5,10]", nil)
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "visits 5-10/20", w.Header().Get("Content-Range"))
+
+		var actualVisits []handlers.Visit
+		err = json.Unmarshal(w.Body.Bytes(), &actualVisits)
+		assert.NoError(t, err)
+
+		for i, visit := range actualVisits {
+			assert.Equal(t, visits[i+5].ID, int64(visit.Id))
+			assert.Equal(t, visits[i+5].LinkID, int64(visit.LinkId))
+			assert.Equal(t, visits[i+5].Ip.String, visit.Ip)
+			assert.Equal(t, visits[i+5].UserAgent.String, visit.UserAgent)
+			assert.Equal(t, visits[i+5].Status, int16(visit.Status))
+			assert.Equal(t, visits[i+5].Referer.String, visit.Referer)
+		}
+	})
+}
+
+func TestLinkVisitsListWithInvalidPagination(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		var err error
+		var visits [2]db.Visit
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			visits[i], err = q.CreateVisit(ctx, db.CreateVisitParams{
+				LinkID:    link.ID,
+				Ip:        sql.NullString{String: "10.0.0.1", Valid: true},
+				UserAgent: sql.NullString{String: "UserAgent", Valid: true},
+				Referer:   sql.NullString{String: "http://localhost/", Valid: true},
+				Status:    302,
+			})
+
+			if err != nil {
+				t.Fatalf("create link visit: %v", err)
+			}
+		}
+
+		cases := []string{
+			"[abc,10]",
+			"[-1,10]",
+			"[20,10]",
+			"asdasd",
+		}
+
+		for _, caseItem := range cases {
+			req, _ := http.NewRequest("GET", fmt.Sprintf("http://localhost/api/link_visits?range=%s", caseItem), nil)
+			authorize(t, ctx, q, req, user)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			expected := `{"error":"invalid range param"}`
+			assert.JSONEq(t, expected, w.Body.String())
+		}
+	})
+}
+
+func TestLinkVisitsListWithFilters(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		var err error
+		var links [2]db.Link
+
+		for i := 0; i < 2; i++ {
+			links[i], err = q.CreateLink(ctx, db.CreateLinkParams{
+				OriginalUrl: "https://google.com",
+				ShortName:   fmt.Sprintf("test%d", i),
+				OwnerID:     user.ID,
+			})
+
+			if err != nil {
+				t.Fatalf("create link: %v", err)
+			}
+		}
+
+		params := []db.CreateVisitParams{
+			{LinkID: links[0].ID, Ip: sql.NullString{String: "10.0.0.1", Valid: true}, Referer: sql.NullString{String: "https://Example.com/page", Valid: true}, Status: 302},
+			{LinkID: links[0].ID, Ip: sql.NullString{String: "10.0.0.2", Valid: true}, Status: 410},
+			{LinkID: links[1].ID, Ip: sql.NullString{String: "10.0.0.1", Valid: true}, Referer: sql.NullString{String: "https://other.org/", Valid: true}, Status: 302},
+		}
+
+		for _, param := range params {
+			if _, err = q.CreateVisit(ctx, param); err != nil {
+				t.Fatalf("create link visit: %v", err)
+			}
+		}
+
+		cases := []struct {
+			query string
+			total int
+		}{
+			{fmt.Sprintf("link_id=%d", links[0].ID), 2},
+			{"status=302", 2},
+			{"referer=example.COM", 1},
+			{"ip=10.0.0.1", 2},
+			{fmt.Sprintf("link_id=%d&status=302&ip=10.0.0.1", links[1].ID), 1},
+			{"status=404", 0},
+		}
+
+		for _, caseItem := range cases {
+			req, _ := http.NewRequest("GET", "http://localhost/api/link_visits?"+caseItem.query, nil)
+			authorize(t, ctx, q, req, user)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code, caseItem.query)
+			assert.Equal(t, fmt.Sprintf("visits 0-9/%d", caseItem.total), w.Header().Get("Content-Range"), caseItem.query)
+
+			var actualVisits []handlers.Visit
+			err = json.Unmarshal(w.Body.Bytes(), &actualVisits)
+			assert.NoError(t, err)
+			assert.Len(t, actualVisits, caseItem.total, caseItem.query)
+		}
+	})
+}
+
+func TestLinkVisitsListWithDateFilter(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		dates := []time.Time{
+			time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+			time.Date(2026, 10, 2, 23, 30, 0, 0, time.UTC),
+			time.Date(2026, 10, 3, 0, 0, 0, 0, time.UTC),
+		}
+
+		for _, date := range dates {
+			visit, err := q.CreateVisit(ctx, db.CreateVisitParams{LinkID: link.ID, Status: 302})
+			if err != nil {
+				t.Fatalf("create link visit: %v", err)
+			}
+
+			if _, err = tx.ExecContext(ctx, "UPDATE visits SET created_at = $1 WHERE id = $2", date, visit.ID); err != nil {
+				t.Fatalf("update link visit: %v", err)
+			}
+		}
+
+		cases := []struct {
+			query string
+			total int
+		}{
+			{"from=2026-10-02", 2},
+			{"to=2026-10-02", 2},
+			{"from=2026-10-02&to=2026-10-02", 1},
+			{"from=2026-10-01T13:00:00Z&to=2026-10-03T00:00:00Z", 1},
+		}
+
+		for _, caseItem := range cases {
+			req, _ := http.NewRequest("GET", fmt.Sprintf("http://localhost/api/links/%d/visits?%s", link.ID, caseItem.query), nil)
+			authorize(t, ctx, q, req, user)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code, caseItem.query)
+			assert.Equal(t, fmt.Sprintf("visits 0-9/%d", caseItem.total), w.Header().Get("Content-Range"), caseItem.query)
+		}
+	})
+}
+
+func TestLinkVisitsListWithInvalidFilters(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		req, _ := http.NewRequest("GET", "http://localhost/api/link_visits?link_id=abc&from=yesterday&status=ok", nil)
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+		expected := `{"errors":{"link_id":"invalid number","from":"invalid date, expected RFC 3339 or YYYY-MM-DD","status":"invalid number"}}`
+		assert.JSONEq(t, expected, w.Body.String())
+	})
+}
+
+func TestLinkVisitsListExcludesBots(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		userAgents := []string{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:124.0) Gecko/20100101 Firefox/124.0",
+			"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+			"curl/8.4.0",
+		}
+
+		for _, userAgent := range userAgents {
+			req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+			req.Header.Set("User-Agent", userAgent)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusFound, w.Code)
+		}
+
+		cases := []struct {
+			query string
+			total int
+		}{
+			{"", 2},
+			{"include_bots=true", 3},
+			{"client_type=bot", 1},
+			{"client_type=suspicious", 1},
+		}
+
+		for _, caseItem := range cases {
+			req, _ := http.NewRequest("GET", "http://localhost/api/link_visits?"+caseItem.query, nil)
+			authorize(t, ctx, q, req, user)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code, caseItem.query)
+			assert.Equal(t, fmt.Sprintf("visits 0-9/%d", caseItem.total), w.Header().Get("Content-Range"), caseItem.query)
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost/api/link_visits?client_type=bot", nil)
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var actualVisits []handlers.Visit
+		err = json.Unmarshal(w.Body.Bytes(), &actualVisits)
+		assert.NoError(t, err)
+		assert.Equal(t, "bot", actualVisits[0].ClientType)
+
+		req, _ = http.NewRequest("GET", fmt.Sprintf("http://localhost/api/links/%d/stats", link.ID), nil)
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var stats handlers.LinkStats
+		err = json.Unmarshal(w.Body.Bytes(), &stats)
+		assert.NoError(t, err)
+
+		assert.Equal(t, int64(2), stats.TotalClicks)
+		assert.Equal(t, []handlers.StatsValue{{Value: "bot", Clicks: 1}, {Value: "human", Clicks: 1}, {Value: "suspicious", Clicks: 1}}, stats.ClientTypes)
+
+		req, _ = http.NewRequest("GET", "http://localhost/api/link_visits?include_bots=maybe&client_type=robot", nil)
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"errors":{"include_bots":"invalid boolean","client_type":"invalid client type, expected human, bot or suspicious"}}`, w.Body.String())
+	})
+}
+
+func TestLinkVisitsListWithUserAgentDetails(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		_, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		userAgents := []string{
+			"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:124.0) Gecko/20100101 Firefox/124.0",
+		}
+
+		for _, userAgent := range userAgents {
+			req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+			req.Header.Set("User-Agent", userAgent)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusFound, w.Code)
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost/api/link_visits?browser=chrome&os=Android&device=mobile", nil)
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "visits 0-9/1", w.Header().Get("Content-Range"))
+
+		var actualVisits []handlers.Visit
+		err = json.Unmarshal(w.Body.Bytes(), &actualVisits)
+		assert.NoError(t, err)
+
+		visit := actualVisits[0]
+		assert.Equal(t, userAgents[0], visit.UserAgent)
+		assert.Equal(t, "Chrome", visit.Browser)
+		assert.Equal(t, "124.0.0.0", visit.BrowserVersion)
+		assert.Equal(t, "Android", visit.Os)
+		assert.Equal(t, "14", visit.OsVersion)
+		assert.Equal(t, "mobile", visit.Device)
+
+		req, _ = http.NewRequest("GET", "http://localhost/api/link_visits?device=phone", nil)
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"errors":{"device":"invalid device, expected desktop, mobile, tablet or bot"}}`, w.Body.String())
+	})
+}
+
+func TestLinkVisitsListByLink(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		var err error
+		var links [2]db.Link
+
+		for i := 0; i < 2; i++ {
+			links[i], err = q.CreateLink(ctx, db.CreateLinkParams{
+				OriginalUrl: "https://google.com",
+				ShortName:   fmt.Sprintf("test%d", i),
+				OwnerID:     user.ID,
+			})
+
+			if err != nil {
+				t.Fatalf("create link: %v", err)
+			}
+
+			for j := 0; j <= i; j++ {
+				if _, err = q.CreateVisit(ctx, db.CreateVisitParams{LinkID: links[i].ID, Status: 302}); err != nil {
+					t.Fatalf("create link visit: %v", err)
+				}
+			}
+		}
+
+		req, _ := http.NewRequest("GET", fmt.Sprintf("http://localhost/api/links/%d/visits", links[1].ID), nil)
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "visits 0-9/2", w.Header().Get("Content-Range"))
+
+		var actualVisits []handlers.Visit
+		err = json.Unmarshal(w.Body.Bytes(), &actualVisits)
+		assert.NoError(t, err)
+
+		for _, visit := range actualVisits {
+			assert.Equal(t, links[1].ID, int64(visit.LinkId))
+		}
+
+		// link_id from the query can't escape the path link
+		req, _ = http.NewRequest("GET", fmt.Sprintf("http://localhost/api/links/%d/visits?link_id=%d", links[1].ID, links[0].ID), nil)
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "visits 0-9/2", w.Header().Get("Content-Range"))
+
+		otherUser := createOtherWorkspaceUser(t, ctx, q)
+		req, _ = http.NewRequest("GET", fmt.Sprintf("http://localhost/api/links/%d/visits", links[1].ID), nil)
+		authorize(t, ctx, q, req, otherUser)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestLinkStats(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		visits := []struct {
+			ip        string
+			referer   string
+			status    int16
+			createdAt time.Time
+		}{
+			{"10.0.0.1", "https://example.com/", 302, time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)},
+			{"10.0.0.1", "https://example.com/", 302, time.Date(2026, 10, 1, 11, 0, 0, 0, time.UTC)},
+			{"10.0.0.2", "https://other.org/", 302, time.Date(2026, 10, 3, 10, 0, 0, 0, time.UTC)},
+			{"10.0.0.3", "", 410, time.Date(2026, 10, 3, 12, 0, 0, 0, time.UTC)},
+			{"10.0.0.4", "", 302, time.Date(2026, 10, 5, 12, 0, 0, 0, time.UTC)},
+		}
+
+		// Visits are rolled up on insert, so they are created with their time
+		for _, item := range visits {
+			_, err := tx.ExecContext(
+				ctx,
+				"INSERT INTO visits (link_id, ip, user_agent, referer, status, created_at) VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)",
+				link.ID, item.ip, "UserAgent", item.referer, item.status, item.createdAt,
+			)
+			if err != nil {
+				t.Fatalf("create link visit: %v", err)
+			}
+		}
+
+		req, _ := http.NewRequest("GET", fmt.Sprintf("http://localhost/api/links/%d/stats?from=2026-10-01&to=2026-10-03&limit=1", link.ID), nil)
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var stats handlers.LinkStats
+		err = json.Unmarshal(w.Body.Bytes(), &stats)
+		assert.NoError(t, err)
+
+		assert.Equal(t, uint64(link.ID), stats.LinkId)
+		assert.Equal(t, "day", stats.Interval)
+		assert.Equal(t, int64(4), stats.TotalClicks)
+		assert.Equal(t, int64(3), stats.UniqueVisitors)
+		assert.Equal(t, []handlers.StatsPoint{
+			{Time: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), Clicks: 2},
+			{Time: time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC), Clicks: 0},
+			{Time: time.Date(2026, 10, 3, 0, 0, 0, 0, time.UTC), Clicks: 2},
+		}, stats.Clicks)
+		assert.Equal(t, []handlers.StatsValue{{Value: "example.com", Clicks: 2}}, stats.TopReferers)
+		assert.Equal(t, []handlers.StatsValue{{Value: "UserAgent", Clicks: 4}}, stats.TopUserAgents)
+		assert.Equal(t, []handlers.StatsStatusItem{{Status: 302, Clicks: 3}, {Status: 410, Clicks: 1}}, stats.Statuses)
+
+		// The window is widened to whole days
+		req, _ = http.NewRequest("GET", fmt.Sprintf("http://localhost/api/links/%d/stats?from=2026-10-01T10:00:00Z&to=2026-10-01T12:00:00Z&interval=hour", link.ID), nil)
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		stats = handlers.LinkStats{}
+		err = json.Unmarshal(w.Body.Bytes(), &stats)
+		assert.NoError(t, err)
+
+		assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), stats.From)
+		assert.Equal(t, time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC), stats.To)
+		assert.Len(t, stats.Clicks, 24)
+		assert.Equal(t, handlers.StatsPoint{Time: time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC), Clicks: 1}, stats.Clicks[10])
+		assert.Equal(t, handlers.StatsPoint{Time: time.Date(2026, 10, 1, 11, 0, 0, 0, time.UTC), Clicks: 1}, stats.Clicks[11])
+		assert.Equal(t, int64(0), stats.Clicks[12].Clicks)
+
+		// Rollups outlive purged visits, except for the visitor hashes
+		_, err = retention.Purge(ctx, q, time.Date(2026, 10, 10, 0, 0, 0, 0, time.UTC), 0)
+		assert.NoError(t, err)
+
+		req, _ = http.NewRequest("GET", fmt.Sprintf("http://localhost/api/links/%d/stats?from=2026-10-01&to=2026-10-03", link.ID), nil)
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		stats = handlers.LinkStats{}
+		err = json.Unmarshal(w.Body.Bytes(), &stats)
+		assert.NoError(t, err)
+
+		assert.Equal(t, int64(4), stats.TotalClicks)
+		assert.Equal(t, int64(0), stats.UniqueVisitors)
+	})
+}
+
+func TestLinkStatsWithInvalidParams(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		cases := map[string]string{
+			"interval=week":                 `{"errors":{"interval":"invalid interval, expected day or hour"}}`,
+			"limit=0":                       `{"errors":{"limit":"invalid number"}}`,
+			"from=2026-10-05&to=2026-10-01": `{"errors":{"from":"invalid time window"}}`,
+			"from=2020-01-01&to=2026-10-01&interval=hour": `{"errors":{"from":"invalid time window"}}`,
+		}
+
+		for query, expected := range cases {
+			req, _ := http.NewRequest("GET", fmt.Sprintf("http://localhost/api/links/%d/stats?%s", link.ID, query), nil)
+			authorize(t, ctx, q, req, user)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code, query)
+			assert.JSONEq(t, expected, w.Body.String(), query)
+		}
+
+		otherUser := createOtherWorkspaceUser(t, ctx, q)
+		req, _ := http.NewRequest("GET", fmt.Sprintf("http://localhost/api/links/%d/stats", link.ID), nil)
+		authorize(t, ctx, q, req, otherUser)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestPurgeVisits(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		user := createUser(t, ctx, q)
+
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		now := time.Now()
+
+		for i := 0; i < 5; i++ {
+			visit, err := q.CreateVisit(ctx, db.CreateVisitParams{LinkID: link.ID, Status: 302})
+			if err != nil {
+				t.Fatalf("create link visit: %v", err)
+			}
+
+			// Three visits are 40 days old
+			if i < 3 {
+				if _, err = tx.ExecContext(ctx, "UPDATE visits SET created_at = $1 WHERE id = $2", now.AddDate(0, 0, -40), visit.ID); err != nil {
+					t.Fatalf("update link visit: %v", err)
+				}
+			}
+		}
+
+		deleted, err := retention.Purge(ctx, q, retention.Cutoff(now, 30), 2)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), deleted)
+
+		count, err := q.GetVisitCount(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+	})
+}
+
+func TestRedirect(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+		req.Header.Add("X-Forwarded-For", "10.0.0.1")
+		req.Header.Add("User-Agent", "Test")
+		req.Header.Add("Referer", "http://localhost/")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://google.com", w.Header().Get("Location"))
+
+		visits, err := q.ListVisits(ctx, db.ListVisitsParams{Limit: 1, Offset: 0})
+
+		if err != nil {
+			t.Fatalf("list visits: %v", err)
+		}
+
+		assert.Equal(t, len(visits), 1)
+
+		visit := visits[0]
+
+		assert.Equal(t, link.ID, visit.LinkID)
+		// assert.Equal(t, "10.0.0.1", visit.Ip.String)
+		assert.Equal(t, "Test", visit.UserAgent.String)
+		assert.Equal(t, "http://localhost/", visit.Referer.String)
+		assert.Equal(t, http.StatusFound, int(visit.Status))
+	})
+}
+
+func TestRedirectWithLinkCache(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		gin.SetMode(gin.TestMode)
+		config := NewConfig(false, "", "8080")
+		router := setupRouter(q, handlers.NewLinkCache(q, 10, time.Minute), handlers.VisitTracker{Recorder: recorder.NewSync(q)}, config)
+		user := createUser(t, ctx, q)
+
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		redirect := func() string {
+			req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			return w.Header().Get("Location")
+		}
+
+		assert.Equal(t, "https://google.com", redirect())
+
+		// Changes made behind the api are not seen until the link is invalidated
+		if _, err = tx.ExecContext(ctx, "UPDATE links SET original_url = 'https://example.com' WHERE id = $1", link.ID); err != nil {
+			t.Fatalf("update link: %v", err)
+		}
+
+		assert.Equal(t, "https://google.com", redirect())
+
+		req, _ := http.NewRequest("PUT", fmt.Sprint("http://localhost/api/links/", link.ID), bytes.NewBufferString(`{"original_url":"https://yandex.ru","short_name":"ABC123"}`))
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "https://yandex.ru", redirect())
+
+		req, _ = http.NewRequest("DELETE", fmt.Sprint("http://localhost/api/links/", link.ID), nil)
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "", redirect())
+	})
+}
+
+func TestRedirectWithGeoip(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		geo, err := geoip.Open("internal/geoip/testdata/GeoIP2-City-Test.mmdb")
+		if err != nil {
+			t.Fatalf("open geoip database: %v", err)
+		}
+
+		defer func() {
+			_ = geo.Close()
+		}()
+
+		gin.SetMode(gin.TestMode)
+		config := NewConfig(false, "", "8080")
+		router := setupRouter(q, handlers.NewLinkCache(q, 0, 0), handlers.VisitTracker{Recorder: recorder.NewSync(q), Geo: geo}, config)
+		user := createUser(t, ctx, q)
+
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		for _, remoteAddr := range []string{"81.2.69.142:40000", "10.0.0.1:40000"} {
+			req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+			req.RemoteAddr = remoteAddr
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusFound, w.Code)
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost/api/link_visits?country=gb", nil)
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "visits 0-9/1", w.Header().Get("Content-Range"))
+
+		var actualVisits []handlers.Visit
+		err = json.Unmarshal(w.Body.Bytes(), &actualVisits)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "GB", actualVisits[0].Country)
+		assert.Equal(t, "England", actualVisits[0].Region)
+		assert.Equal(t, "London", actualVisits[0].City)
+
+		req, _ = http.NewRequest("GET", fmt.Sprintf("http://localhost/api/links/%d/stats", link.ID), nil)
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var stats handlers.LinkStats
+		err = json.Unmarshal(w.Body.Bytes(), &stats)
+		assert.NoError(t, err)
+
+		assert.Equal(t, []handlers.StatsValue{{Value: "", Clicks: 1}, {Value: "GB", Clicks: 1}}, stats.TopCountries)
+		assert.Equal(t, []handlers.StatsCity{{Country: "GB", City: "London", Clicks: 1}}, stats.TopCities)
+	})
+}
+
+func TestRedirectWithPrivacy(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		geo, err := geoip.Open("internal/geoip/testdata/GeoIP2-City-Test.mmdb")
+		if err != nil {
+			t.Fatalf("open geoip database: %v", err)
+		}
+
+		defer func() {
+			_ = geo.Close()
+		}()
+
+		policy, err := privacy.New(privacy.Options{
+			IpMode:      privacy.IpTruncate,
+			DntMode:     privacy.DntMinimize,
+			RefererMode: privacy.RefererOrigin,
+		})
+		if err != nil {
+			t.Fatalf("create privacy policy: %v", err)
+		}
+
+		gin.SetMode(gin.TestMode)
+		config := NewConfig(false, "", "8080")
+		tracker := handlers.VisitTracker{Recorder: recorder.NewSync(q), Geo: geo, Privacy: policy}
+		router := setupRouter(q, handlers.NewLinkCache(q, 0, 0), tracker, config)
+		user := createUser(t, ctx, q)
+
+		_, err = q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		for _, dnt := range []string{"", "1"} {
+			req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+			req.RemoteAddr = "81.2.69.142:40000"
+			req.Header.Set("User-Agent", "Test")
+			req.Header.Set("Referer", "https://example.com/private/page?token=secret")
+			req.Header.Set("DNT", dnt)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusFound, w.Code)
+		}
+
+		visits, err := q.ListVisits(ctx, db.ListVisitsParams{Limit: 2, Offset: 0})
+		if err != nil {
+			t.Fatalf("list visits: %v", err)
+		}
+
+		assert.Len(t, visits, 2)
+
+		assert.Equal(t, "81.2.69.0", visits[0].Ip.String)
+		assert.Equal(t, "https://example.com/", visits[0].Referer.String)
+		assert.Equal(t, "Test", visits[0].UserAgent.String)
+		assert.Equal(t, "London", visits[0].City.String)
+
+		assert.False(t, visits[1].Ip.Valid)
+		assert.False(t, visits[1].Referer.Valid)
+		assert.False(t, visits[1].UserAgent.Valid)
+		assert.False(t, visits[1].City.Valid)
+		assert.Equal(t, "GB", visits[1].Country.String)
+	})
+}
+
+func TestRedirectExpired(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			ExpiresAt:   sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusGone, w.Code)
+		assert.JSONEq(t, `{"error":"link expired"}`, w.Body.String())
+
+		visits, err := q.ListVisits(ctx, db.ListVisitsParams{Limit: 1, Offset: 0})
+
+		if err != nil {
+			t.Fatalf("list visits: %v", err)
+		}
+
+		assert.Equal(t, 1, len(visits))
+		assert.Equal(t, link.ID, visits[0].LinkID)
+		assert.Equal(t, http.StatusGone, int(visits[0].Status))
+	})
+}
+
+func TestRedirectExpiredWithExpiredUrl(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		_, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			ExpiresAt:   sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+			ExpiredUrl:  sql.NullString{String: "https://google.com/expired", Valid: true},
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://google.com/expired", w.Header().Get("Location"))
+	})
+}
+
+func TestRedirectNotYetExpired(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		_, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			ExpiresAt:   sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+			ExpiredUrl:  sql.NullString{String: "https://google.com/expired", Valid: true},
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://google.com", w.Header().Get("Location"))
+	})
+}
+
+func TestRedirectMaxVisits(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		link, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			MaxVisits:   sql.NullInt32{Int32: 2, Valid: true},
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		// A link preview doesn't use up a visit
+		for _, userAgent := range []string{"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", "", ""} {
+			req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+			req.Header.Set("User-Agent", userAgent)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusFound, w.Code)
+		}
+
+		for _, userAgent := range []string{"", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"} {
+			req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+			req.Header.Set("User-Agent", userAgent)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusGone, w.Code)
+			assert.JSONEq(t, `{"error":"link visits limit reached"}`, w.Body.String())
+		}
+
+		link, err = q.GetLink(ctx, link.ID)
+		if err != nil {
+			t.Fatalf("get link: %v", err)
+		}
+
+		assert.Equal(t, int32(2), link.VisitsCount)
+	})
+}
+
+func TestRedirectMaxVisitsWithHtml(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		_, err := q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl: "https://google.com",
+			ShortName:   "ABC123",
+			MaxVisits:   sql.NullInt32{Int32: 1, Valid: true},
+			OwnerID:     user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		for _, code := range []int{http.StatusFound, http.StatusGone} {
+			req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+			req.Header.Add("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, code, w.Code)
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+		req.Header.Add("Accept", "text/html")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusGone, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+		assert.Contains(t, w.Body.String(), "link visits limit reached")
+	})
+}
+
+func TestRedirectWithRedirectType(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		gin.SetMode(gin.TestMode)
+		config := NewConfig(false, "", "8080")
+		config.RedirectType = http.StatusTemporaryRedirect
+		router := setupRouter(q, handlers.NewLinkCache(q, 0, 0), handlers.VisitTracker{Recorder: recorder.NewSync(q)}, config)
+		user := createUser(t, ctx, q)
+
+		links := map[string]sql.NullInt16{
+			"ABC123": {},
+			"ABC124": {Int16: http.StatusMovedPermanently, Valid: true},
+		}
+
+		for shortName, redirectType := range links {
+			_, err := q.CreateLink(ctx, db.CreateLinkParams{
+				OriginalUrl:  "https://google.com",
+				ShortName:    shortName,
+				RedirectType: redirectType,
+				OwnerID:      user.ID,
 			})
 
-			if err != nil {
-				t.Fatalf("create link visit: %v", err)
-			}
+			if err != nil {
+				t.Fatalf("create link: %v", err)
+			}
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+		req, _ = http.NewRequest("GET", "http://localhost/r/ABC124", nil)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "https://google.com", w.Header().Get("Location"))
+		assert.Empty(t, w.Header().Get("Cache-Control"))
+
+		// Browsers would keep following a cached permanent redirect past the expiry or the visit limit
+		limited := []db.CreateLinkParams{
+			{ShortName: "ABC125", RedirectType: sql.NullInt16{Int16: http.StatusMovedPermanently, Valid: true}, MaxVisits: sql.NullInt32{Int32: 10, Valid: true}},
+			{ShortName: "ABC126", RedirectType: sql.NullInt16{Int16: http.StatusPermanentRedirect, Valid: true}, ExpiresAt: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}},
+		}
+		codes := []int{http.StatusFound, http.StatusTemporaryRedirect}
+
+		for i, params := range limited {
+			params.OriginalUrl = "https://google.com"
+			params.OwnerID = user.ID
+			if _, err := q.CreateLink(ctx, params); err != nil {
+				t.Fatalf("create link: %v", err)
+			}
+
+			req, _ := http.NewRequest("GET", "http://localhost/r/"+params.ShortName, nil)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, codes[i], w.Code, params.ShortName)
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"), params.ShortName)
+		}
+	})
+}
+
+func TestRedirectWithForwarding(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		links := []db.CreateLinkParams{
+			{OriginalUrl: "https://docs.example.com/guide/?lang=en&ref=short", ShortName: "ABC123", ForwardQuery: true, ForwardPath: true},
+			{OriginalUrl: "https://example.com/?lang=en", ShortName: "ABC124"},
+		}
+
+		for _, params := range links {
+			params.OwnerID = user.ID
+			if _, err := q.CreateLink(ctx, params); err != nil {
+				t.Fatalf("create link: %v", err)
+			}
+		}
+
+		cases := []struct {
+			path     string
+			code     int
+			location string
+		}{
+			{"/r/ABC123", http.StatusFound, "https://docs.example.com/guide/?lang=en&ref=short"},
+			{"/r/ABC123/", http.StatusFound, "https://docs.example.com/guide/?lang=en&ref=short"},
+			{"/r/ABC123/install/linux?utm_source=x&lang=de", http.StatusFound, "https://docs.example.com/guide/install/linux?ref=short&utm_source=x&lang=de"},
+			{"/r/ABC123?b=2&a=1&a=3&sig=A%2Fb", http.StatusFound, "https://docs.example.com/guide/?lang=en&ref=short&b=2&a=1&a=3&sig=A%2Fb"},
+			{"/r/ABC123/../../admin/", http.StatusFound, "https://docs.example.com/guide/admin/?lang=en&ref=short"},
+			{"/r/ABC124?utm_source=x", http.StatusFound, "https://example.com/?lang=en"},
+			{"/r/ABC124/install", http.StatusNotFound, ""},
+		}
+
+		for _, caseItem := range cases {
+			req, _ := http.NewRequest("GET", "http://localhost"+caseItem.path, nil)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, caseItem.code, w.Code, caseItem.path)
+			assert.Equal(t, caseItem.location, w.Header().Get("Location"), caseItem.path)
+		}
+	})
+}
+
+func TestRedirectWithTargeting(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		body := `{
+			"original_url":"https://example.com",
+			"short_name":"testtest",
+			"utm":{"source":"print"},
+			"targeting":{
+				"user_agents":[{"pattern":"Pixel \\d+","url":"https://example.com/pixel"}],
+				"ios":"https://apps.apple.com/app/id1",
+				"android":"https://play.google.com/store/apps/details?id=app"
+			}
+		}`
+		req, _ := http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var actualLink handlers.Link
+		err := json.Unmarshal(w.Body.Bytes(), &actualLink)
+		assert.NoError(t, err)
+		assert.Equal(t, &handlers.LinkTargeting{
+			UserAgents: []handlers.LinkUserAgentRule{{Pattern: `Pixel \d+`, Url: "https://example.com/pixel"}},
+			Ios:        "https://apps.apple.com/app/id1",
+			Android:    "https://play.google.com/store/apps/details?id=app",
+		}, actualLink.Targeting)
+
+		cases := map[string]string{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1": "https://apps.apple.com/app/id1?utm_source=print",
+			"Mozilla/5.0 (Linux; Android 14; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36":                  "https://play.google.com/store/apps/details?id=app&utm_source=print",
+			"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36":                   "https://example.com/pixel?utm_source=print",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:124.0) Gecko/20100101 Firefox/124.0":                                                        "https://example.com?utm_source=print",
+		}
+
+		for userAgent, location := range cases {
+			req, _ := http.NewRequest("GET", "http://localhost/r/testtest", nil)
+			req.Header.Add("User-Agent", userAgent)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusFound, w.Code, userAgent)
+			assert.Equal(t, location, w.Header().Get("Location"), userAgent)
+		}
+
+		body = `{"original_url":"https://example.com","short_name":"testtest2","targeting":{"user_agents":[{"pattern":"(","url":"https://example.com"}]}}`
+		req, _ = http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.JSONEq(t, `{"errors":{"targeting":"user agent rule 0: error parsing regexp: missing closing ): `+"`(`"+`"}}`, w.Body.String())
+	})
+}
+
+func TestRedirectWithGeoTargeting(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		geo, err := geoip.Open("internal/geoip/testdata/GeoIP2-City-Test.mmdb")
+		if err != nil {
+			t.Fatalf("open geoip database: %v", err)
 		}
 
-		req, _ := http.NewRequest("GET", "http://localhost/api/link_visits", nil)
+		defer func() {
+			_ = geo.Close()
+		}()
+
+		gin.SetMode(gin.TestMode)
+		config := NewConfig(false, "", "8080")
+		router := setupRouter(q, handlers.NewLinkCache(q, 0, 0), handlers.VisitTracker{Recorder: recorder.NewSync(q), Geo: geo}, config)
+		user := createUser(t, ctx, q)
+
+		body := `{"original_url":"https://example.com","short_name":"testtest","targeting":{"countries":{"GB":"https://example.co.uk","DE":"https://example.de"}}}`
+		req, _ := http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
 
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
 
-		assert.Equal(t, http.StatusOK, w.Code)
-		assert.Equal(t, "visits 0-9/2", w.Header().Get("Content-Range"))
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		cases := []struct {
+			remoteAddr string
+			location   string
+		}{
+			{"81.2.69.142:40000", "https://example.co.uk"},
+			{"10.0.0.1:40000", "https://example.com"},
+		}
+
+		for _, caseItem := range cases {
+			req, _ := http.NewRequest("GET", "http://localhost/r/testtest", nil)
+			req.RemoteAddr = caseItem.remoteAddr
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusFound, w.Code, caseItem.remoteAddr)
+			assert.Equal(t, caseItem.location, w.Header().Get("Location"), caseItem.remoteAddr)
+		}
+
+		req, _ = http.NewRequest("GET", "http://localhost/api/link_visits", nil)
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
 
 		var actualVisits []handlers.Visit
 		err = json.Unmarshal(w.Body.Bytes(), &actualVisits)
 		assert.NoError(t, err)
 
-		for i, visit := range actualVisits {
-			assert.Equal(t, visits[i].ID, int64(visit.Id))
-			assert.Equal(t, visits[i].LinkID, int64(visit.LinkId))
-			assert.Equal(t, visits[i].Ip.String, visit.Ip)
-			assert.Equal(t, visits[i].UserAgent.String, visit.UserAgent)
-			assert.Equal(t, visits[i].Status, int16(visit.Status))
-			assert.Equal(t, visits[i].Referer.String, visit.Referer)
-		}
+		assert.Len(t, actualVisits, 2)
+		assert.Equal(t, "GB", actualVisits[0].Country)
+		assert.Equal(t, "country:GB", actualVisits[0].Target)
+		assert.Equal(t, "", actualVisits[1].Target)
+
+		body = `{"original_url":"https://example.com","short_name":"testtest2","targeting":{"countries":{"XX":"https://example.com"}}}`
+		req, _ = http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
 	})
 }
 
-func TestLinkVistsListWithPagination(t *testing.T) {
+func TestRedirectWithVariants(t *testing.T) {
 	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
 		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		body := `{
+			"original_url":"https://example.com",
+			"short_name":"testtest",
+			"sticky_variants":true,
+			"variants":[
+				{"name":"a","url":"https://example.com/a","weight":1},
+				{"name":"b","url":"https://example.com/b","weight":0}
+			]
+		}`
+		req, _ := http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
 
-		var err error
-		var visits [20]db.Visit
-		link, err := q.CreateLink(ctx, db.CreateLinkParams{
-			OriginalUrl: "https://google.com",
-			ShortName:   "ABC123",
-		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
 
-		if err != nil {
-			t.Fatalf("create link: %v", err)
-		}
+		assert.Equal(t, http.StatusCreated, w.Code)
 
-		for i := 0; i < 20; i++ {
-			visits[i], err = q.CreateVisit(ctx, db.CreateVisitParams{
-				LinkID:    link.ID,
-				Ip:        sql.NullString{String: "10.0.0.1", Valid: true},
-				UserAgent: sql.NullString{String: "UserAgent", Valid: true},
-				Referer:   sql.NullString{String: "http://localhost/", Valid: true},
-				Status:    302,
-			})
+		var actualLink handlers.Link
+		err := json.Unmarshal(w.Body.Bytes(), &actualLink)
+		assert.NoError(t, err)
+		assert.True(t, actualLink.StickyVariants)
+		assert.Len(t, actualLink.Variants, 2)
 
-			if err != nil {
-				t.Fatalf("create link visit: %v", err)
-			}
-		}
+		cookieName := fmt.Sprintf("variant_%d", actualLink.Id)
 
-		req, _ := http.NewRequest("GET", "http://localhost/api/link_visits?range=[5,10]", nil)
+		req, _ = http.NewRequest("GET", "http://localhost/r/testtest", nil)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com/a", w.Header().Get("Location"))
+		assert.Contains(t, w.Header().Get("Set-Cookie"), cookieName+"=a")
+
+		// Returning visitors keep their variant without a new cookie
+		req, _ = http.NewRequest("GET", "http://localhost/r/testtest", nil)
+		req.AddCookie(&http.Cookie{Name: cookieName, Value: "a"})
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "https://example.com/a", w.Header().Get("Location"))
+		assert.Empty(t, w.Header().Get("Set-Cookie"))
+
+		// Paused variants are picked again
+		req, _ = http.NewRequest("GET", "http://localhost/r/testtest", nil)
+		req.AddCookie(&http.Cookie{Name: cookieName, Value: "b"})
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "https://example.com/a", w.Header().Get("Location"))
+		assert.Contains(t, w.Header().Get("Set-Cookie"), cookieName+"=a")
+
+		req, _ = http.NewRequest("GET", "http://localhost/api/link_visits", nil)
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var actualVisits []handlers.Visit
+		err = json.Unmarshal(w.Body.Bytes(), &actualVisits)
+		assert.NoError(t, err)
+		assert.Len(t, actualVisits, 3)
+		assert.Equal(t, "a", actualVisits[0].Variant)
+
+		req, _ = http.NewRequest("GET", fmt.Sprintf("http://localhost/api/links/%d/stats?limit=1", actualLink.Id), nil)
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var stats handlers.LinkStats
+		err = json.Unmarshal(w.Body.Bytes(), &stats)
+		assert.NoError(t, err)
+		assert.Equal(t, []handlers.StatsValue{{Value: "a", Clicks: 3}}, stats.Variants)
+
+		body = `{"original_url":"https://example.com","short_name":"testtest2","variants":[{"name":"a","url":"https://example.com/a","weight":1},{"name":"a","url":"https://example.com/b","weight":1}]}`
+		req, _ = http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.JSONEq(t, `{"errors":{"variants":"duplicate variant name \"a\""}}`, w.Body.String())
+	})
+}
+
+func TestRedirectWithSchedule(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		now := time.Now().UTC()
+		body := fmt.Sprintf(`{
+			"original_url":"https://example.com",
+			"short_name":"testtest",
+			"redirect_type":301,
+			"targeting":{"desktop":"https://example.com/desktop"},
+			"schedule":[
+				{"ends_at":%q,"url":"https://example.com/teaser"},
+				{"starts_at":%q,"ends_at":%q,"url":"https://example.com/sale"},
+				{"starts_at":%q,"url":"https://example.com/archive"}
+			]
+		}`,
+			now.Add(-time.Hour).Format(time.RFC3339),
+			now.Add(-time.Minute).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339),
+			now.Add(time.Hour).Format(time.RFC3339),
+		)
+		req, _ := http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
 
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
 
-		assert.Equal(t, http.StatusOK, w.Code)
-		assert.Equal(t, "visits 5-10/20", w.Header().Get("Content-Range"))
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var actualLink handlers.Link
+		err := json.Unmarshal(w.Body.Bytes(), &actualLink)
+		assert.NoError(t, err)
+		assert.Len(t, actualLink.Schedule, 3)
+
+		// The active entry wins over targeting
+		req, _ = http.NewRequest("GET", "http://localhost/r/testtest", nil)
+		req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:124.0) Gecko/20100101 Firefox/124.0")
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		// Never cached by browsers, the next entry must reach returning visitors
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		assert.Equal(t, "https://example.com/sale", w.Header().Get("Location"))
+
+		req, _ = http.NewRequest("GET", "http://localhost/api/link_visits", nil)
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
 
 		var actualVisits []handlers.Visit
 		err = json.Unmarshal(w.Body.Bytes(), &actualVisits)
 		assert.NoError(t, err)
+		assert.Equal(t, "schedule:1", actualVisits[0].Target)
 
-		for i, visit := range actualVisits {
-			assert.Equal(t, visits[i+5].ID, int64(visit.Id))
-			assert.Equal(t, visits[i+5].LinkID, int64(visit.LinkId))
-			assert.Equal(t, visits[i+5].Ip.String, visit.Ip)
-			assert.Equal(t, visits[i+5].UserAgent.String, visit.UserAgent)
-			assert.Equal(t, visits[i+5].Status, int16(visit.Status))
-			assert.Equal(t, visits[i+5].Referer.String, visit.Referer)
-		}
+		body = `{"original_url":"https://example.com","short_name":"testtest2","schedule":[{"starts_at":"2026-12-01T00:00:00Z","ends_at":"2026-11-01T00:00:00Z","url":"https://example.com"}]}`
+		req, _ = http.NewRequest("POST", "http://localhost/api/links", bytes.NewBufferString(body))
+		authorize(t, ctx, q, req, user)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.JSONEq(t, `{"errors":{"schedule":"entry 0: ends_at must be after starts_at"}}`, w.Body.String())
 	})
 }
 
-func TestLinkVisitsListWithInvalidPagination(t *testing.T) {
+func TestRedirectWithPassword(t *testing.T) {
 	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
 		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+		if err != nil {
+			t.Fatalf("hash password: %v", err)
+		}
 
-		var err error
-		var visits [2]db.Visit
 		link, err := q.CreateLink(ctx, db.CreateLinkParams{
-			OriginalUrl: "https://google.com",
-			ShortName:   "ABC123",
+			OriginalUrl:  "https://google.com",
+			ShortName:    "ABC123",
+			PasswordHash: sql.NullString{String: string(hash), Valid: true},
+			OwnerID:      user.ID,
 		})
 
 		if err != nil {
 			t.Fatalf("create link: %v", err)
 		}
 
-		for i := 0; i < 2; i++ {
-			visits[i], err = q.CreateVisit(ctx, db.CreateVisitParams{
-				LinkID:    link.ID,
-				Ip:        sql.NullString{String: "10.0.0.1", Valid: true},
-				UserAgent: sql.NullString{String: "UserAgent", Valid: true},
-				Referer:   sql.NullString{String: "http://localhost/", Valid: true},
-				Status:    302,
-			})
+		req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+		req.Header.Add("Accept", "text/html")
 
-			if err != nil {
-				t.Fatalf("create link visit: %v", err)
-			}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `name="password"`)
+
+		req, _ = http.NewRequest("GET", "http://localhost/r/ABC123", nil)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.JSONEq(t, `{"error":"password required"}`, w.Body.String())
+
+		form := url.Values{"password": {"wrong"}}
+		req, _ = http.NewRequest("POST", "http://localhost/r/ABC123", bytes.NewBufferString(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Accept", "text/html")
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid password")
+
+		form = url.Values{"password": {"secret"}}
+		req, _ = http.NewRequest("POST", "http://localhost/r/ABC123", bytes.NewBufferString(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusSeeOther, w.Code)
+		assert.Equal(t, "https://google.com", w.Header().Get("Location"))
+
+		visits, err := q.ListVisits(ctx, db.ListVisitsParams{Limit: 10, Offset: 0})
+		if err != nil {
+			t.Fatalf("list visits: %v", err)
 		}
 
-		cases := []string{
-			"[abc,10]",
-			"[-1,10]",
-			"[20,10]",
-			"asdasd",
+		if assert.Equal(t, 2, len(visits)) {
+			assert.Equal(t, link.ID, visits[0].LinkID)
+			assert.Equal(t, http.StatusUnauthorized, int(visits[0].Status))
+			assert.Equal(t, http.StatusSeeOther, int(visits[1].Status))
 		}
+	})
+}
 
-		for _, caseItem := range cases {
-			req, _ := http.NewRequest("GET", fmt.Sprintf("http://localhost/api/link_visits?range=%s", caseItem), nil)
+func TestRedirectWithPasswordThrottled(t *testing.T) {
+	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
+		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
+
+		hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+		if err != nil {
+			t.Fatalf("hash password: %v", err)
+		}
+
+		_, err = q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl:  "https://google.com",
+			ShortName:    "ABC123",
+			PasswordHash: sql.NullString{String: string(hash), Valid: true},
+			OwnerID:      user.ID,
+		})
+
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+
+		post := func(password string) *httptest.ResponseRecorder {
+			form := url.Values{"password": {password}}
+			req, _ := http.NewRequest("POST", "http://localhost/r/ABC123", bytes.NewBufferString(form.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
 			w := httptest.NewRecorder()
 			router.ServeHTTP(w, req)
+			return w
+		}
 
-			assert.Equal(t, http.StatusBadRequest, w.Code)
-
-			expected := `{"error":"invalid range param"}`
-			assert.JSONEq(t, expected, w.Body.String())
+		for i := 0; i < 5; i++ {
+			w := post("wrong")
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
 		}
+
+		w := post("secret")
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		assert.JSONEq(t, `{"error":"too many password attempts, try again later"}`, w.Body.String())
 	})
 }
 
-func TestRedirect(t *testing.T) {
+func TestRedirectWithPasswordThrottledConcurrently(t *testing.T) {
 	withTx(t, func(ctx context.Context, q *db.Queries, tx *sql.Tx) {
 		router := setupTestRouterWithQueries(q)
+		user := createUser(t, ctx, q)
 
-		link, err := q.CreateLink(ctx, db.CreateLinkParams{
-			OriginalUrl: "https://google.com",
-			ShortName:   "ABC123",
+		hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+		if err != nil {
+			t.Fatalf("hash password: %v", err)
+		}
+
+		_, err = q.CreateLink(ctx, db.CreateLinkParams{
+			OriginalUrl:  "https://google.com",
+			ShortName:    "ABC123",
+			PasswordHash: sql.NullString{String: string(hash), Valid: true},
+			OwnerID:      user.ID,
 		})
 
 		if err != nil {
 			t.Fatalf("create link: %v", err)
 		}
 
-		req, _ := http.NewRequest("GET", "http://localhost/r/ABC123", nil)
-		req.Header.Add("X-Forwarded-For", "10.0.0.1")
-		req.Header.Add("User-Agent", "Test")
-		req.Header.Add("Referer", "http://localhost/")
-
-		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		codes := make([]int, 20)
+		var wg sync.WaitGroup
 
-		assert.Equal(t, http.StatusFound, w.Code)
-		assert.Equal(t, "https://google.com", w.Header().Get("Location"))
+		for i := range codes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
 
-		visits, err := q.ListVisits(ctx, db.ListVisitsParams{Limit: 1, Offset: 0})
+				form := url.Values{"password": {"wrong"}}
+				req, _ := http.NewRequest("POST", "http://localhost/r/ABC123", bytes.NewBufferString(form.Encode()))
+				req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-		if err != nil {
-			t.Fatalf("list visits: %v", err)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				codes[i] = w.Code
+			}()
 		}
 
-		assert.Equal(t, len(visits), 1)
+		wg.Wait()
 
-		visit := visits[0]
+		counts := map[int]int{}
+		for _, code := range codes {
+			counts[code]++
+		}
 
-		assert.Equal(t, link.ID, visit.LinkID)
-		// assert.Equal(t, "10.0.0.1", visit.Ip.String)
-		assert.Equal(t, "Test", visit.UserAgent.String)
-		assert.Equal(t, "http://localhost/", visit.Referer.String)
-		assert.Equal(t, http.StatusFound, int(visit.Status))
+		assert.Equal(t, map[int]int{http.StatusUnauthorized: 5, http.StatusTooManyRequests: 15}, counts)
 	})
 }
 
@@ -768,12 +3084,75 @@ func withTx(t *testing.T, fn func(ctx context.Context, q *db.Queries, tx *sql.Tx
 	fn(ctx, qtx, tx)
 }
 
+func createUser(t *testing.T, ctx context.Context, q *db.Queries) db.User {
+	t.Helper()
+
+	workspace, err := q.GetDefaultWorkspace(ctx)
+	if err != nil {
+		t.Fatalf("get default workspace: %v", err)
+	}
+
+	return createWorkspaceUser(t, ctx, q, workspace, handlers.RoleAdmin)
+}
+
+func createWorkspaceUser(t *testing.T, ctx context.Context, q *db.Queries, workspace db.Workspace, role string) db.User {
+	t.Helper()
+
+	user, err := q.CreateUser(ctx, db.CreateUserParams{
+		Name:        fmt.Sprintf("user%d", time.Now().UnixNano()),
+		WorkspaceID: workspace.ID,
+		Role:        role,
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	return user
+}
+
+func createOtherWorkspaceUser(t *testing.T, ctx context.Context, q *db.Queries) db.User {
+	t.Helper()
+
+	workspace, err := q.CreateWorkspace(ctx, db.CreateWorkspaceParams{
+		Name:   "other",
+		Domain: sql.NullString{String: "other.example.com", Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+
+	return createWorkspaceUser(t, ctx, q, workspace, handlers.RoleAdmin)
+}
+
+func authorize(t *testing.T, ctx context.Context, q *db.Queries, req *http.Request, user db.User) {
+	t.Helper()
+
+	key, err := internal.GenerateApiKey()
+	if err != nil {
+		t.Fatalf("generate api key: %v", err)
+	}
+
+	_, err = q.CreateApiKey(ctx, db.CreateApiKeyParams{
+		Name:    "test",
+		Prefix:  key[:internal.ApiKeyPrefixLen],
+		KeyHash: internal.HashApiKey(key),
+		UserID:  user.ID,
+	})
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+
+	req.Header.Set("Api-Key", key)
+}
+
 func setupTestRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
-	return setupRouter(db.New(conn), NewConfig(false, "", "8080"))
+	return setupTestRouterWithQueries(db.New(conn))
 }
 
 func setupTestRouterWithQueries(queries *db.Queries) *gin.Engine {
 	gin.SetMode(gin.TestMode)
-	return setupRouter(queries, NewConfig(false, "", "8080"))
+	config := NewConfig(false, "", "8080")
+	linkCache := handlers.NewLinkCache(queries, config.LinkCacheSize, config.LinkCacheTTL)
+	return setupRouter(queries, linkCache, handlers.VisitTracker{Recorder: recorder.NewSync(queries)}, config)
 }
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/darkartx/go-project-278/handlers"
+	"github.com/darkartx/go-project-278/internal"
+	"github.com/darkartx/go-project-278/internal/retention"
+
+	db "github.com/darkartx/go-project-278/db/generated"
+)
+
+var ErrorUnknownCommand = errors.New("unknown command")
+
+func runCommand(config *Config, args []string) error {
+	if len(args) == 0 {
+		return Api(config)
+	}
+
+	switch args[0] {
+	case "serve", "s":
+		return serveCommand(config, args[1:])
+	case "api-key":
+		return apiKeyCommand(config, args[1:])
+	case "user":
+		return userCommand(config, args[1:])
+	case "workspace":
+		return workspaceCommand(config, args[1:])
+	case "purge-visits":
+		return purgeVisitsCommand(config, args[1:])
+	case "purge-links":
+		return purgeLinksCommand(config, args[1:])
+	}
+
+	return fmt.Errorf("%w: %s", ErrorUnknownCommand, args[0])
+}
+
+func serveCommand(config *Config, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	port := flags.String("p", "", "api port")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *port != "" {
+		config.Bind = fmt.Sprintf("0.0.0.0:%s", *port)
+	}
+
+	return Api(config)
+}
+
+func purgeVisitsCommand(config *Config, args []string) error {
+	flags := flag.NewFlagSet("purge-visits", flag.ContinueOnError)
+	days := flags.Int("days", config.VisitRetentionDays, "delete visits older than days, VISIT_RETENTION_DAYS by default")
+	batchSize := flags.Int("batch", retention.DefaultBatchSize, "visits deleted at once")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *days <= 0 {
+		return errors.New("purge-visits: -days or VISIT_RETENTION_DAYS is required")
+	}
+
+	return withQueries(config, func(queries *db.Queries) error {
+		before := retention.Cutoff(time.Now(), *days)
+
+		deleted, err := retention.Purge(context.Background(), queries, before, int32(*batchSize))
+		fmt.Printf("Deleted %d visits created before %s\n", deleted, before.Format(time.RFC3339))
+
+		return err
+	})
+}
+
+func purgeLinksCommand(config *Config, args []string) error {
+	flags := flag.NewFlagSet("purge-links", flag.ContinueOnError)
+	days := flags.Int("days", config.LinkTrashDays, "delete links trashed more than days ago, LINK_TRASH_DAYS by default")
+	batchSize := flags.Int("batch", retention.DefaultBatchSize, "links deleted at once")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *days < 0 {
+		return errors.New("purge-links: -days must not be negative")
+	}
+
+	return withQueries(config, func(queries *db.Queries) error {
+		before := retention.Cutoff(time.Now(), *days)
+
+		deleted, err := retention.PurgeLinks(context.Background(), queries, before, int32(*batchSize))
+		fmt.Printf("Deleted %d links trashed before %s\n", deleted, before.Format(time.RFC3339))
+
+		return err
+	})
+}
+
+func withQueries(config *Config, fn func(queries *db.Queries) error) error {
+	database, err := setupDB(config)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = database.Close()
+	}()
+
+	return fn(db.New(database))
+}
+
+func apiKeyCommand(config *Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: api-key requires one of create, list, revoke", ErrorUnknownCommand)
+	}
+
+	return withQueries(config, func(queries *db.Queries) error {
+		switch args[0] {
+		case "create":
+			return apiKeyCreateCommand(queries, args[1:])
+		case "list":
+			return apiKeyListCommand(queries)
+		case "revoke":
+			return apiKeyRevokeCommand(queries, args[1:])
+		}
+
+		return fmt.Errorf("%w: api-key %s", ErrorUnknownCommand, args[0])
+	})
+}
+
+func apiKeyCreateCommand(queries *db.Queries, args []string) error {
+	flags := flag.NewFlagSet("api-key create", flag.ContinueOnError)
+	name := flags.String("name", "", "key name")
+	userId := flags.Int64("user", 0, "id of the user the key acts as")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return errors.New("api-key create: -name is required")
+	}
+
+	user, err := queries.GetUser(context.Background(), *userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("api-key create: user %d not found", *userId)
+		}
+
+		return err
+	}
+
+	key, err := internal.GenerateApiKey()
+	if err != nil {
+		return err
+	}
+
+	apiKey, err := queries.CreateApiKey(context.Background(), db.CreateApiKeyParams{
+		Name:    *name,
+		Prefix:  key[:internal.ApiKeyPrefixLen],
+		KeyHash: internal.HashApiKey(key),
+		UserID:  user.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created api key %d (%s) for user %s. It is shown only once:\n%s\n", apiKey.ID, apiKey.Name, user.Name, key)
+
+	return nil
+}
+
+func apiKeyListCommand(queries *db.Queries) error {
+	apiKeys, err := queries.ListApiKeys(context.Background())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tUSER\tPREFIX\tCREATED\tREVOKED")
+
+	for _, apiKey := range apiKeys {
+		revoked := "-"
+		if apiKey.RevokedAt.Valid {
+			revoked = apiKey.RevokedAt.Time.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\n", apiKey.ID, apiKey.Name, apiKey.UserID, apiKey.Prefix, apiKey.CreatedAt.Format(time.RFC3339), revoked)
+	}
+
+	return w.Flush()
+}
+
+func apiKeyRevokeCommand(queries *db.Queries, args []string) error {
+	flags := flag.NewFlagSet("api-key revoke", flag.ContinueOnError)
+	id := flags.Int64("id", 0, "key id")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	apiKey, err := queries.RevokeApiKey(context.Background(), *id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("api-key revoke: active key %d not found", *id)
+		}
+
+		return err
+	}
+
+	fmt.Printf("Revoked api key %d (%s)\n", apiKey.ID, apiKey.Name)
+
+	return nil
+}
+
+func userCommand(config *Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: user requires one of create, list", ErrorUnknownCommand)
+	}
+
+	return withQueries(config, func(queries *db.Queries) error {
+		switch args[0] {
+		case "create":
+			return userCreateCommand(queries, args[1:])
+		case "list":
+			return userListCommand(queries)
+		}
+
+		return fmt.Errorf("%w: user %s", ErrorUnknownCommand, args[0])
+	})
+}
+
+func userCreateCommand(queries *db.Queries, args []string) error {
+	flags := flag.NewFlagSet("user create", flag.ContinueOnError)
+	name := flags.String("name", "", "user name")
+	workspaceId := flags.Int64("workspace", 0, "workspace id, the default workspace if omitted")
+	role := flags.String("role", handlers.RoleViewer, "user role: viewer, editor or admin")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return errors.New("user create: -name is required")
+	}
+
+	if !handlers.IsValidRole(*role) {
+		return fmt.Errorf("user create: invalid role %s", *role)
+	}
+
+	var workspace db.Workspace
+	var err error
+
+	if *workspaceId == 0 {
+		workspace, err = queries.GetDefaultWorkspace(context.Background())
+	} else {
+		workspace, err = queries.GetWorkspace(context.Background(), *workspaceId)
+	}
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("user create: workspace %d not found", *workspaceId)
+		}
+
+		return err
+	}
+
+	user, err := queries.CreateUser(context.Background(), db.CreateUserParams{
+		Name:        *name,
+		WorkspaceID: workspace.ID,
+		Role:        *role,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created %s %d (%s) in workspace %s\n", user.Role, user.ID, user.Name, workspace.Name)
+
+	return nil
+}
+
+func userListCommand(queries *db.Queries) error {
+	users, err := queries.ListUsers(context.Background())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tROLE\tWORKSPACE\tCREATED")
+
+	for _, user := range users {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\n", user.ID, user.Name, user.Role, user.WorkspaceID, user.CreatedAt.Format(time.RFC3339))
+	}
+
+	return w.Flush()
+}
+
+func workspaceCommand(config *Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: workspace requires one of create, list", ErrorUnknownCommand)
+	}
+
+	return withQueries(config, func(queries *db.Queries) error {
+		switch args[0] {
+		case "create":
+			return workspaceCreateCommand(queries, args[1:])
+		case "list":
+			return workspaceListCommand(queries)
+		}
+
+		return fmt.Errorf("%w: workspace %s", ErrorUnknownCommand, args[0])
+	})
+}
+
+func workspaceCreateCommand(queries *db.Queries, args []string) error {
+	flags := flag.NewFlagSet("workspace create", flag.ContinueOnError)
+	name := flags.String("name", "", "workspace name")
+	domain := flags.String("domain", "", "custom domain serving the workspace short links")
+	maxLinks := flags.Int("max-links", 0, "link quota, unlimited if omitted")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return errors.New("workspace create: -name is required")
+	}
+
+	// Without a domain the workspace links could never be reached, the default workspace serves all other hosts
+	if *domain == "" {
+		return errors.New("workspace create: -domain is required")
+	}
+
+	workspace, err := queries.CreateWorkspace(context.Background(), db.CreateWorkspaceParams{
+		Name:     *name,
+		Domain:   sql.NullString{String: strings.ToLower(*domain), Valid: true},
+		MaxLinks: sql.NullInt32{Int32: int32(*maxLinks), Valid: *maxLinks > 0},
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created workspace %d (%s)\n", workspace.ID, workspace.Name)
+
+	return nil
+}
+
+func workspaceListCommand(queries *db.Queries) error {
+	workspaces, err := queries.ListWorkspaces(context.Background())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tDOMAIN\tMAX LINKS\tCREATED")
+
+	for _, workspace := range workspaces {
+		domain := "-"
+		if workspace.Domain.Valid {
+			domain = workspace.Domain.String
+		}
+
+		maxLinks := "-"
+		if workspace.MaxLinks.Valid {
+			maxLinks = strconv.Itoa(int(workspace.MaxLinks.Int32))
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", workspace.ID, workspace.Name, domain, maxLinks, workspace.CreatedAt.Format(time.RFC3339))
+	}
+
+	return w.Flush()
+}
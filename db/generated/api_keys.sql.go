@@ -0,0 +1,196 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: api_keys.sql
+
+package db
+
+import (
+	"context"
+)
+
+const createApiKey = `-- name: CreateApiKey :one
+INSERT INTO api_keys (name, prefix, key_hash, user_id) VALUES ($1, $2, $3, $4) RETURNING id, name, prefix, key_hash, created_at, revoked_at, user_id
+`
+
+type CreateApiKeyParams struct {
+	Name    string
+	Prefix  string
+	KeyHash string
+	UserID  int64
+}
+
+func (q *Queries) CreateApiKey(ctx context.Context, arg CreateApiKeyParams) (ApiKey, error) {
+	row := q.db.QueryRowContext(ctx, createApiKey,
+		arg.Name,
+		arg.Prefix,
+		arg.KeyHash,
+		arg.UserID,
+	)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Prefix,
+		&i.KeyHash,
+		&i.CreatedAt,
+		&i.RevokedAt,
+		&i.UserID,
+	)
+	return i, err
+}
+
+const getActiveApiKeyByHash = `-- name: GetActiveApiKeyByHash :one
+SELECT api_keys.id, api_keys.name, api_keys.prefix, api_keys.key_hash, api_keys.created_at, api_keys.revoked_at, api_keys.user_id, users.id, users.name, users.created_at, users.workspace_id, users.role, workspaces.id, workspaces.name, workspaces.domain, workspaces.max_links, workspaces.is_default, workspaces.created_at FROM api_keys
+JOIN users ON users.id = api_keys.user_id
+JOIN workspaces ON workspaces.id = users.workspace_id
+WHERE api_keys.key_hash = $1 AND api_keys.revoked_at IS NULL
+`
+
+type GetActiveApiKeyByHashRow struct {
+	ApiKey    ApiKey
+	User      User
+	Workspace Workspace
+}
+
+func (q *Queries) GetActiveApiKeyByHash(ctx context.Context, keyHash string) (GetActiveApiKeyByHashRow, error) {
+	row := q.db.QueryRowContext(ctx, getActiveApiKeyByHash, keyHash)
+	var i GetActiveApiKeyByHashRow
+	err := row.Scan(
+		&i.ApiKey.ID,
+		&i.ApiKey.Name,
+		&i.ApiKey.Prefix,
+		&i.ApiKey.KeyHash,
+		&i.ApiKey.CreatedAt,
+		&i.ApiKey.RevokedAt,
+		&i.ApiKey.UserID,
+		&i.User.ID,
+		&i.User.Name,
+		&i.User.CreatedAt,
+		&i.User.WorkspaceID,
+		&i.User.Role,
+		&i.Workspace.ID,
+		&i.Workspace.Name,
+		&i.Workspace.Domain,
+		&i.Workspace.MaxLinks,
+		&i.Workspace.IsDefault,
+		&i.Workspace.CreatedAt,
+	)
+	return i, err
+}
+
+const listApiKeys = `-- name: ListApiKeys :many
+SELECT id, name, prefix, key_hash, created_at, revoked_at, user_id FROM api_keys ORDER BY id
+`
+
+func (q *Queries) ListApiKeys(ctx context.Context) ([]ApiKey, error) {
+	rows, err := q.db.QueryContext(ctx, listApiKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ApiKey
+	for rows.Next() {
+		var i ApiKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Prefix,
+			&i.KeyHash,
+			&i.CreatedAt,
+			&i.RevokedAt,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWorkspaceApiKeys = `-- name: ListWorkspaceApiKeys :many
+SELECT api_keys.id, api_keys.name, api_keys.prefix, api_keys.key_hash, api_keys.created_at, api_keys.revoked_at, api_keys.user_id FROM api_keys JOIN users ON users.id = api_keys.user_id WHERE users.workspace_id = $1 ORDER BY api_keys.id
+`
+
+func (q *Queries) ListWorkspaceApiKeys(ctx context.Context, workspaceID int64) ([]ApiKey, error) {
+	rows, err := q.db.QueryContext(ctx, listWorkspaceApiKeys, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ApiKey
+	for rows.Next() {
+		var i ApiKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Prefix,
+			&i.KeyHash,
+			&i.CreatedAt,
+			&i.RevokedAt,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeApiKey = `-- name: RevokeApiKey :one
+UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL RETURNING id, name, prefix, key_hash, created_at, revoked_at, user_id
+`
+
+func (q *Queries) RevokeApiKey(ctx context.Context, id int64) (ApiKey, error) {
+	row := q.db.QueryRowContext(ctx, revokeApiKey, id)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Prefix,
+		&i.KeyHash,
+		&i.CreatedAt,
+		&i.RevokedAt,
+		&i.UserID,
+	)
+	return i, err
+}
+
+const revokeWorkspaceApiKey = `-- name: RevokeWorkspaceApiKey :one
+UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP
+WHERE api_keys.id = $1 AND api_keys.revoked_at IS NULL
+    AND api_keys.user_id IN (SELECT users.id FROM users WHERE users.workspace_id = $2)
+RETURNING id, name, prefix, key_hash, created_at, revoked_at, user_id
+`
+
+type RevokeWorkspaceApiKeyParams struct {
+	ID          int64
+	WorkspaceID int64
+}
+
+func (q *Queries) RevokeWorkspaceApiKey(ctx context.Context, arg RevokeWorkspaceApiKeyParams) (ApiKey, error) {
+	row := q.db.QueryRowContext(ctx, revokeWorkspaceApiKey, arg.ID, arg.WorkspaceID)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Prefix,
+		&i.KeyHash,
+		&i.CreatedAt,
+		&i.RevokedAt,
+		&i.UserID,
+	)
+	return i, err
+}
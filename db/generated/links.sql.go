@@ -7,19 +7,76 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
 )
 
+const consumeLinkVisit = `-- name: ConsumeLinkVisit :one
+UPDATE links SET visits_count = visits_count + 1 WHERE id = $1 AND visits_count < max_visits RETURNING visits_count
+`
+
+func (q *Queries) ConsumeLinkVisit(ctx context.Context, id int64) (int32, error) {
+	row := q.db.QueryRowContext(ctx, consumeLinkVisit, id)
+	var visits_count int32
+	err := row.Scan(&visits_count)
+	return visits_count, err
+}
+
 const createLink = `-- name: CreateLink :one
-INSERT INTO links (original_url, short_name) VALUES ($1, $2) RETURNING id, original_url, short_name, created_at, updated_at
+INSERT INTO links (
+    original_url, short_name, expires_at, expired_url, max_visits, password_hash, redirect_type, forward_query, forward_path,
+    utm_source, utm_medium, utm_campaign, utm_term, utm_content, targeting, variants, sticky_variants, schedule, owner_id, workspace_id
+)
+VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, (SELECT workspace_id FROM users WHERE users.id = $19)
+) RETURNING id, original_url, short_name, created_at, updated_at, expires_at, expired_url, max_visits, visits_count, password_hash, owner_id, workspace_id, redirect_type, forward_query, forward_path, utm_source, utm_medium, utm_campaign, utm_term, utm_content, targeting, variants, sticky_variants, schedule, deleted_at
 `
 
 type CreateLinkParams struct {
-	OriginalUrl string
-	ShortName   string
+	OriginalUrl    string
+	ShortName      string
+	ExpiresAt      sql.NullTime
+	ExpiredUrl     sql.NullString
+	MaxVisits      sql.NullInt32
+	PasswordHash   sql.NullString
+	RedirectType   sql.NullInt16
+	ForwardQuery   bool
+	ForwardPath    bool
+	UtmSource      sql.NullString
+	UtmMedium      sql.NullString
+	UtmCampaign    sql.NullString
+	UtmTerm        sql.NullString
+	UtmContent     sql.NullString
+	Targeting      json.RawMessage
+	Variants       json.RawMessage
+	StickyVariants bool
+	Schedule       json.RawMessage
+	OwnerID        int64
 }
 
 func (q *Queries) CreateLink(ctx context.Context, arg CreateLinkParams) (Link, error) {
-	row := q.db.QueryRowContext(ctx, createLink, arg.OriginalUrl, arg.ShortName)
+	row := q.db.QueryRowContext(ctx, createLink,
+		arg.OriginalUrl,
+		arg.ShortName,
+		arg.ExpiresAt,
+		arg.ExpiredUrl,
+		arg.MaxVisits,
+		arg.PasswordHash,
+		arg.RedirectType,
+		arg.ForwardQuery,
+		arg.ForwardPath,
+		arg.UtmSource,
+		arg.UtmMedium,
+		arg.UtmCampaign,
+		arg.UtmTerm,
+		arg.UtmContent,
+		arg.Targeting,
+		arg.Variants,
+		arg.StickyVariants,
+		arg.Schedule,
+		arg.OwnerID,
+	)
 	var i Link
 	err := row.Scan(
 		&i.ID,
@@ -27,21 +84,52 @@ func (q *Queries) CreateLink(ctx context.Context, arg CreateLinkParams) (Link, e
 		&i.ShortName,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.ExpiredUrl,
+		&i.MaxVisits,
+		&i.VisitsCount,
+		&i.PasswordHash,
+		&i.OwnerID,
+		&i.WorkspaceID,
+		&i.RedirectType,
+		&i.ForwardQuery,
+		&i.ForwardPath,
+		&i.UtmSource,
+		&i.UtmMedium,
+		&i.UtmCampaign,
+		&i.UtmTerm,
+		&i.UtmContent,
+		&i.Targeting,
+		&i.Variants,
+		&i.StickyVariants,
+		&i.Schedule,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
-const deleteLink = `-- name: DeleteLink :exec
-DELETE FROM links WHERE id = $1
+const deleteTrashedLinksBefore = `-- name: DeleteTrashedLinksBefore :execrows
+DELETE FROM links WHERE id IN (
+    SELECT old.id FROM links AS old WHERE old.deleted_at < $1::TIMESTAMPTZ ORDER BY old.id LIMIT $2
+)
 `
 
-func (q *Queries) DeleteLink(ctx context.Context, id int64) error {
-	_, err := q.db.ExecContext(ctx, deleteLink, id)
-	return err
+type DeleteTrashedLinksBeforeParams struct {
+	Before time.Time
+	Limit  int32
+}
+
+// Visits and rollups of the links are purged first, see retention.PurgeLinks
+func (q *Queries) DeleteTrashedLinksBefore(ctx context.Context, arg DeleteTrashedLinksBeforeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteTrashedLinksBefore, arg.Before, arg.Limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const getLink = `-- name: GetLink :one
-SELECT id, original_url, short_name, created_at, updated_at FROM links WHERE id = $1
+SELECT id, original_url, short_name, created_at, updated_at, expires_at, expired_url, max_visits, visits_count, password_hash, owner_id, workspace_id, redirect_type, forward_query, forward_path, utm_source, utm_medium, utm_campaign, utm_term, utm_content, targeting, variants, sticky_variants, schedule, deleted_at FROM links WHERE id = $1
 `
 
 func (q *Queries) GetLink(ctx context.Context, id int64) (Link, error) {
@@ -53,16 +141,46 @@ func (q *Queries) GetLink(ctx context.Context, id int64) (Link, error) {
 		&i.ShortName,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.ExpiredUrl,
+		&i.MaxVisits,
+		&i.VisitsCount,
+		&i.PasswordHash,
+		&i.OwnerID,
+		&i.WorkspaceID,
+		&i.RedirectType,
+		&i.ForwardQuery,
+		&i.ForwardPath,
+		&i.UtmSource,
+		&i.UtmMedium,
+		&i.UtmCampaign,
+		&i.UtmTerm,
+		&i.UtmContent,
+		&i.Targeting,
+		&i.Variants,
+		&i.StickyVariants,
+		&i.Schedule,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getLinkByShortName = `-- name: GetLinkByShortName :one
-SELECT id, original_url, short_name, created_at, updated_at FROM links WHERE short_name = $1
+SELECT links.id, links.original_url, links.short_name, links.created_at, links.updated_at, links.expires_at, links.expired_url, links.max_visits, links.visits_count, links.password_hash, links.owner_id, links.workspace_id, links.redirect_type, links.forward_query, links.forward_path, links.utm_source, links.utm_medium, links.utm_campaign, links.utm_term, links.utm_content, links.targeting, links.variants, links.sticky_variants, links.schedule, links.deleted_at FROM links
+WHERE links.short_name = $1 AND links.workspace_id = (
+    SELECT workspaces.id FROM workspaces WHERE workspaces.domain = $2 OR workspaces.is_default ORDER BY workspaces.is_default LIMIT 1
+)
 `
 
-func (q *Queries) GetLinkByShortName(ctx context.Context, shortName string) (Link, error) {
-	row := q.db.QueryRowContext(ctx, getLinkByShortName, shortName)
+type GetLinkByShortNameParams struct {
+	ShortName string
+	Domain    sql.NullString
+}
+
+// Links are looked up in the workspace bound to the request domain, falling back to the default one.
+// Trashed links are found too, redirects answer them with 410 Gone
+func (q *Queries) GetLinkByShortName(ctx context.Context, arg GetLinkByShortNameParams) (Link, error) {
+	row := q.db.QueryRowContext(ctx, getLinkByShortName, arg.ShortName, arg.Domain)
 	var i Link
 	err := row.Scan(
 		&i.ID,
@@ -70,32 +188,151 @@ func (q *Queries) GetLinkByShortName(ctx context.Context, shortName string) (Lin
 		&i.ShortName,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.ExpiredUrl,
+		&i.MaxVisits,
+		&i.VisitsCount,
+		&i.PasswordHash,
+		&i.OwnerID,
+		&i.WorkspaceID,
+		&i.RedirectType,
+		&i.ForwardQuery,
+		&i.ForwardPath,
+		&i.UtmSource,
+		&i.UtmMedium,
+		&i.UtmCampaign,
+		&i.UtmTerm,
+		&i.UtmContent,
+		&i.Targeting,
+		&i.Variants,
+		&i.StickyVariants,
+		&i.Schedule,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getLinkCount = `-- name: GetLinkCount :one
-SELECT COUNT(*) FROM links
+SELECT COUNT(*) FROM links WHERE workspace_id = $1 AND (deleted_at IS NOT NULL) = $2::BOOLEAN
 `
 
-func (q *Queries) GetLinkCount(ctx context.Context) (int64, error) {
-	row := q.db.QueryRowContext(ctx, getLinkCount)
+type GetLinkCountParams struct {
+	WorkspaceID int64
+	Trashed     bool
+}
+
+// Lists either the links in use or the trashed ones
+func (q *Queries) GetLinkCount(ctx context.Context, arg GetLinkCountParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getLinkCount, arg.WorkspaceID, arg.Trashed)
 	var count int64
 	err := row.Scan(&count)
 	return count, err
 }
 
+const getOwnedLink = `-- name: GetOwnedLink :one
+SELECT id, original_url, short_name, created_at, updated_at, expires_at, expired_url, max_visits, visits_count, password_hash, owner_id, workspace_id, redirect_type, forward_query, forward_path, utm_source, utm_medium, utm_campaign, utm_term, utm_content, targeting, variants, sticky_variants, schedule, deleted_at FROM links WHERE id = $1 AND owner_id = $2 AND deleted_at IS NULL
+`
+
+type GetOwnedLinkParams struct {
+	ID      int64
+	OwnerID int64
+}
+
+// Editors only change links of their own
+func (q *Queries) GetOwnedLink(ctx context.Context, arg GetOwnedLinkParams) (Link, error) {
+	row := q.db.QueryRowContext(ctx, getOwnedLink, arg.ID, arg.OwnerID)
+	var i Link
+	err := row.Scan(
+		&i.ID,
+		&i.OriginalUrl,
+		&i.ShortName,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.ExpiredUrl,
+		&i.MaxVisits,
+		&i.VisitsCount,
+		&i.PasswordHash,
+		&i.OwnerID,
+		&i.WorkspaceID,
+		&i.RedirectType,
+		&i.ForwardQuery,
+		&i.ForwardPath,
+		&i.UtmSource,
+		&i.UtmMedium,
+		&i.UtmCampaign,
+		&i.UtmTerm,
+		&i.UtmContent,
+		&i.Targeting,
+		&i.Variants,
+		&i.StickyVariants,
+		&i.Schedule,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getWorkspaceLink = `-- name: GetWorkspaceLink :one
+SELECT id, original_url, short_name, created_at, updated_at, expires_at, expired_url, max_visits, visits_count, password_hash, owner_id, workspace_id, redirect_type, forward_query, forward_path, utm_source, utm_medium, utm_campaign, utm_term, utm_content, targeting, variants, sticky_variants, schedule, deleted_at FROM links WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NULL
+`
+
+type GetWorkspaceLinkParams struct {
+	ID          int64
+	WorkspaceID int64
+}
+
+func (q *Queries) GetWorkspaceLink(ctx context.Context, arg GetWorkspaceLinkParams) (Link, error) {
+	row := q.db.QueryRowContext(ctx, getWorkspaceLink, arg.ID, arg.WorkspaceID)
+	var i Link
+	err := row.Scan(
+		&i.ID,
+		&i.OriginalUrl,
+		&i.ShortName,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.ExpiredUrl,
+		&i.MaxVisits,
+		&i.VisitsCount,
+		&i.PasswordHash,
+		&i.OwnerID,
+		&i.WorkspaceID,
+		&i.RedirectType,
+		&i.ForwardQuery,
+		&i.ForwardPath,
+		&i.UtmSource,
+		&i.UtmMedium,
+		&i.UtmCampaign,
+		&i.UtmTerm,
+		&i.UtmContent,
+		&i.Targeting,
+		&i.Variants,
+		&i.StickyVariants,
+		&i.Schedule,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
 const listLinks = `-- name: ListLinks :many
-SELECT id, original_url, short_name, created_at, updated_at FROM links ORDER BY id LIMIT $1 OFFSET $2
+SELECT id, original_url, short_name, created_at, updated_at, expires_at, expired_url, max_visits, visits_count, password_hash, owner_id, workspace_id, redirect_type, forward_query, forward_path, utm_source, utm_medium, utm_campaign, utm_term, utm_content, targeting, variants, sticky_variants, schedule, deleted_at FROM links WHERE workspace_id = $1 AND (deleted_at IS NOT NULL) = $2::BOOLEAN
+ORDER BY id LIMIT $4 OFFSET $3
 `
 
 type ListLinksParams struct {
-	Limit  int32
-	Offset int32
+	WorkspaceID int64
+	Trashed     bool
+	Offset      int32
+	Limit       int32
 }
 
 func (q *Queries) ListLinks(ctx context.Context, arg ListLinksParams) ([]Link, error) {
-	rows, err := q.db.QueryContext(ctx, listLinks, arg.Limit, arg.Offset)
+	rows, err := q.db.QueryContext(ctx, listLinks,
+		arg.WorkspaceID,
+		arg.Trashed,
+		arg.Offset,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -109,6 +346,26 @@ func (q *Queries) ListLinks(ctx context.Context, arg ListLinksParams) ([]Link, e
 			&i.ShortName,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.ExpiresAt,
+			&i.ExpiredUrl,
+			&i.MaxVisits,
+			&i.VisitsCount,
+			&i.PasswordHash,
+			&i.OwnerID,
+			&i.WorkspaceID,
+			&i.RedirectType,
+			&i.ForwardQuery,
+			&i.ForwardPath,
+			&i.UtmSource,
+			&i.UtmMedium,
+			&i.UtmCampaign,
+			&i.UtmTerm,
+			&i.UtmContent,
+			&i.Targeting,
+			&i.Variants,
+			&i.StickyVariants,
+			&i.Schedule,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -123,18 +380,132 @@ func (q *Queries) ListLinks(ctx context.Context, arg ListLinksParams) ([]Link, e
 	return items, nil
 }
 
+const peekLinkVisit = `-- name: PeekLinkVisit :one
+SELECT visits_count FROM links WHERE id = $1 AND visits_count < max_visits
+`
+
+// Like ConsumeLinkVisit without using the visit up
+func (q *Queries) PeekLinkVisit(ctx context.Context, id int64) (int32, error) {
+	row := q.db.QueryRowContext(ctx, peekLinkVisit, id)
+	var visits_count int32
+	err := row.Scan(&visits_count)
+	return visits_count, err
+}
+
+const restoreLink = `-- name: RestoreLink :one
+UPDATE links SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NOT NULL RETURNING id, original_url, short_name, created_at, updated_at, expires_at, expired_url, max_visits, visits_count, password_hash, owner_id, workspace_id, redirect_type, forward_query, forward_path, utm_source, utm_medium, utm_campaign, utm_term, utm_content, targeting, variants, sticky_variants, schedule, deleted_at
+`
+
+type RestoreLinkParams struct {
+	ID          int64
+	WorkspaceID int64
+}
+
+func (q *Queries) RestoreLink(ctx context.Context, arg RestoreLinkParams) (Link, error) {
+	row := q.db.QueryRowContext(ctx, restoreLink, arg.ID, arg.WorkspaceID)
+	var i Link
+	err := row.Scan(
+		&i.ID,
+		&i.OriginalUrl,
+		&i.ShortName,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.ExpiredUrl,
+		&i.MaxVisits,
+		&i.VisitsCount,
+		&i.PasswordHash,
+		&i.OwnerID,
+		&i.WorkspaceID,
+		&i.RedirectType,
+		&i.ForwardQuery,
+		&i.ForwardPath,
+		&i.UtmSource,
+		&i.UtmMedium,
+		&i.UtmCampaign,
+		&i.UtmTerm,
+		&i.UtmContent,
+		&i.Targeting,
+		&i.Variants,
+		&i.StickyVariants,
+		&i.Schedule,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const trashLink = `-- name: TrashLink :exec
+UPDATE links SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NULL
+`
+
+type TrashLinkParams struct {
+	ID          int64
+	WorkspaceID int64
+}
+
+func (q *Queries) TrashLink(ctx context.Context, arg TrashLinkParams) error {
+	_, err := q.db.ExecContext(ctx, trashLink, arg.ID, arg.WorkspaceID)
+	return err
+}
+
 const updateLink = `-- name: UpdateLink :one
-UPDATE links SET original_url = $1, short_name = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3 RETURNING id, original_url, short_name, created_at, updated_at
+UPDATE links SET
+    visits_count = CASE WHEN max_visits IS NULL AND $5::INTEGER IS NOT NULL THEN (
+        SELECT COUNT(*) FROM visits WHERE visits.link_id = links.id AND visits."status" BETWEEN 300 AND 399 AND visits.client_type <> 'bot'
+    ) ELSE visits_count END,
+    original_url = $1, short_name = $2, expires_at = $3, expired_url = $4, max_visits = $5, password_hash = $6, redirect_type = $7,
+    forward_query = $8, forward_path = $9, utm_source = $10, utm_medium = $11, utm_campaign = $12, utm_term = $13, utm_content = $14,
+    targeting = $15, variants = $16, sticky_variants = $17, schedule = $18, updated_at = CURRENT_TIMESTAMP
+WHERE links.id = $19 AND links.owner_id = $20 AND links.deleted_at IS NULL RETURNING id, original_url, short_name, created_at, updated_at, expires_at, expired_url, max_visits, visits_count, password_hash, owner_id, workspace_id, redirect_type, forward_query, forward_path, utm_source, utm_medium, utm_campaign, utm_term, utm_content, targeting, variants, sticky_variants, schedule, deleted_at
 `
 
 type UpdateLinkParams struct {
-	OriginalUrl string
-	ShortName   string
-	ID          int64
+	OriginalUrl    string
+	ShortName      string
+	ExpiresAt      sql.NullTime
+	ExpiredUrl     sql.NullString
+	MaxVisits      sql.NullInt32
+	PasswordHash   sql.NullString
+	RedirectType   sql.NullInt16
+	ForwardQuery   bool
+	ForwardPath    bool
+	UtmSource      sql.NullString
+	UtmMedium      sql.NullString
+	UtmCampaign    sql.NullString
+	UtmTerm        sql.NullString
+	UtmContent     sql.NullString
+	Targeting      json.RawMessage
+	Variants       json.RawMessage
+	StickyVariants bool
+	Schedule       json.RawMessage
+	ID             int64
+	OwnerID        int64
 }
 
+// visits_count is only kept up to date for links with max_visits, a new limit counts the redirects made so far
 func (q *Queries) UpdateLink(ctx context.Context, arg UpdateLinkParams) (Link, error) {
-	row := q.db.QueryRowContext(ctx, updateLink, arg.OriginalUrl, arg.ShortName, arg.ID)
+	row := q.db.QueryRowContext(ctx, updateLink,
+		arg.OriginalUrl,
+		arg.ShortName,
+		arg.ExpiresAt,
+		arg.ExpiredUrl,
+		arg.MaxVisits,
+		arg.PasswordHash,
+		arg.RedirectType,
+		arg.ForwardQuery,
+		arg.ForwardPath,
+		arg.UtmSource,
+		arg.UtmMedium,
+		arg.UtmCampaign,
+		arg.UtmTerm,
+		arg.UtmContent,
+		arg.Targeting,
+		arg.Variants,
+		arg.StickyVariants,
+		arg.Schedule,
+		arg.ID,
+		arg.OwnerID,
+	)
 	var i Link
 	err := row.Scan(
 		&i.ID,
@@ -142,6 +513,26 @@ func (q *Queries) UpdateLink(ctx context.Context, arg UpdateLinkParams) (Link, e
 		&i.ShortName,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.ExpiredUrl,
+		&i.MaxVisits,
+		&i.VisitsCount,
+		&i.PasswordHash,
+		&i.OwnerID,
+		&i.WorkspaceID,
+		&i.RedirectType,
+		&i.ForwardQuery,
+		&i.ForwardPath,
+		&i.UtmSource,
+		&i.UtmMedium,
+		&i.UtmCampaign,
+		&i.UtmTerm,
+		&i.UtmContent,
+		&i.Targeting,
+		&i.Variants,
+		&i.StickyVariants,
+		&i.Schedule,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -6,23 +6,91 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+type ApiKey struct {
+	ID        int64
+	Name      string
+	Prefix    string
+	KeyHash   string
+	CreatedAt time.Time
+	RevokedAt sql.NullTime
+	UserID    int64
+}
+
 type Link struct {
+	ID             int64
+	OriginalUrl    string
+	ShortName      string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	ExpiresAt      sql.NullTime
+	ExpiredUrl     sql.NullString
+	MaxVisits      sql.NullInt32
+	VisitsCount    int32
+	PasswordHash   sql.NullString
+	OwnerID        int64
+	WorkspaceID    int64
+	RedirectType   sql.NullInt16
+	ForwardQuery   bool
+	ForwardPath    bool
+	UtmSource      sql.NullString
+	UtmMedium      sql.NullString
+	UtmCampaign    sql.NullString
+	UtmTerm        sql.NullString
+	UtmContent     sql.NullString
+	Targeting      json.RawMessage
+	Variants       json.RawMessage
+	StickyVariants bool
+	Schedule       json.RawMessage
+	DeletedAt      sql.NullTime
+}
+
+type User struct {
 	ID          int64
-	OriginalUrl string
-	ShortName   string
+	Name        string
 	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	WorkspaceID int64
+	Role        string
 }
 
 type Visit struct {
+	ID             int64
+	LinkID         int64
+	Ip             sql.NullString
+	UserAgent      sql.NullString
+	Referer        sql.NullString
+	Status         int16
+	CreatedAt      time.Time
+	ClientType     string
+	Browser        sql.NullString
+	BrowserVersion sql.NullString
+	Os             sql.NullString
+	OsVersion      sql.NullString
+	Device         sql.NullString
+	Country        sql.NullString
+	Region         sql.NullString
+	City           sql.NullString
+	Target         sql.NullString
+	Variant        sql.NullString
+}
+
+type VisitDailyStat struct {
+	LinkID     int64
+	Day        time.Time
+	ClientType string
+	Dimension  string
+	Value      string
+	Clicks     int64
+}
+
+type Workspace struct {
 	ID        int64
-	LinkID    int64
-	Ip        sql.NullString
-	UserAgent sql.NullString
-	Referer   sql.NullString
-	Status    int16
+	Name      string
+	Domain    sql.NullString
+	MaxLinks  sql.NullInt32
+	IsDefault bool
 	CreatedAt time.Time
 }
@@ -0,0 +1,24 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: notify.sql
+
+package db
+
+import (
+	"context"
+)
+
+const notify = `-- name: Notify :exec
+SELECT pg_notify($1::TEXT, $2::TEXT)
+`
+
+type NotifyParams struct {
+	Channel string
+	Payload string
+}
+
+func (q *Queries) Notify(ctx context.Context, arg NotifyParams) error {
+	_, err := q.db.ExecContext(ctx, notify, arg.Channel, arg.Payload)
+	return err
+}
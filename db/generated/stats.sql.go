@@ -0,0 +1,288 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: stats.sql
+
+package db
+
+import (
+	"context"
+	"time"
+)
+
+const deleteTrashedLinkStatsBefore = `-- name: DeleteTrashedLinkStatsBefore :execrows
+DELETE FROM visit_daily_stats WHERE (link_id, dimension, "day", client_type, "value") IN (
+    SELECT old.link_id, old.dimension, old.day, old.client_type, old.value FROM visit_daily_stats AS old
+    JOIN links ON links.id = old.link_id
+    WHERE links.deleted_at < $1::TIMESTAMPTZ
+    LIMIT $2
+)
+`
+
+type DeleteTrashedLinkStatsBeforeParams struct {
+	Before time.Time
+	Limit  int32
+}
+
+// Rollups of links trashed before the time, purged in batches ahead of the links
+func (q *Queries) DeleteTrashedLinkStatsBefore(ctx context.Context, arg DeleteTrashedLinkStatsBeforeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteTrashedLinkStatsBefore, arg.Before, arg.Limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteVisitorStatsBefore = `-- name: DeleteVisitorStatsBefore :execrows
+DELETE FROM visit_daily_stats WHERE (link_id, dimension, "day", client_type, "value") IN (
+    SELECT old.link_id, old.dimension, old.day, old.client_type, old.value FROM visit_daily_stats AS old
+    WHERE old.dimension = 'visitor' AND old.day < $1::DATE
+    LIMIT $2
+)
+`
+
+type DeleteVisitorStatsBeforeParams struct {
+	Before time.Time
+	Limit  int32
+}
+
+// Visitor hashes are personal data and follow the visits retention, the other dimensions are kept
+func (q *Queries) DeleteVisitorStatsBefore(ctx context.Context, arg DeleteVisitorStatsBeforeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteVisitorStatsBefore, arg.Before, arg.Limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getLinkVisitTotals = `-- name: GetLinkVisitTotals :one
+
+SELECT
+    COALESCE(SUM(clicks) FILTER (WHERE dimension = 'total'), 0)::BIGINT AS total_clicks,
+    COUNT(DISTINCT "value") FILTER (WHERE dimension = 'visitor') AS unique_visitors
+FROM visit_daily_stats
+WHERE link_id = $1 AND dimension IN ('total', 'visitor')
+    AND "day" >= $2::DATE AND "day" < $3::DATE
+    AND ($4::BOOLEAN OR client_type <> 'bot')
+`
+
+type GetLinkVisitTotalsParams struct {
+	LinkID      int64
+	DayFrom     time.Time
+	DayTo       time.Time
+	IncludeBots bool
+}
+
+type GetLinkVisitTotalsRow struct {
+	TotalClicks    int64
+	UniqueVisitors int64
+}
+
+// Stats are read from the daily rollups only, windows are whole UTC days
+func (q *Queries) GetLinkVisitTotals(ctx context.Context, arg GetLinkVisitTotalsParams) (GetLinkVisitTotalsRow, error) {
+	row := q.db.QueryRowContext(ctx, getLinkVisitTotals,
+		arg.LinkID,
+		arg.DayFrom,
+		arg.DayTo,
+		arg.IncludeBots,
+	)
+	var i GetLinkVisitTotalsRow
+	err := row.Scan(&i.TotalClicks, &i.UniqueVisitors)
+	return i, err
+}
+
+const listLinkTopValues = `-- name: ListLinkTopValues :many
+SELECT "value", SUM(clicks)::BIGINT AS clicks
+FROM visit_daily_stats
+WHERE link_id = $1 AND dimension = $2
+    AND "day" >= $3::DATE AND "day" < $4::DATE
+    AND ($5::BOOLEAN OR client_type <> 'bot')
+GROUP BY "value" ORDER BY clicks DESC, "value" LIMIT $6
+`
+
+type ListLinkTopValuesParams struct {
+	LinkID      int64
+	Dimension   string
+	DayFrom     time.Time
+	DayTo       time.Time
+	IncludeBots bool
+	Limit       int32
+}
+
+type ListLinkTopValuesRow struct {
+	Value  string
+	Clicks int64
+}
+
+func (q *Queries) ListLinkTopValues(ctx context.Context, arg ListLinkTopValuesParams) ([]ListLinkTopValuesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listLinkTopValues,
+		arg.LinkID,
+		arg.Dimension,
+		arg.DayFrom,
+		arg.DayTo,
+		arg.IncludeBots,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListLinkTopValuesRow
+	for rows.Next() {
+		var i ListLinkTopValuesRow
+		if err := rows.Scan(&i.Value, &i.Clicks); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLinkVisitClientTypes = `-- name: ListLinkVisitClientTypes :many
+SELECT client_type, SUM(clicks)::BIGINT AS clicks
+FROM visit_daily_stats
+WHERE link_id = $1 AND dimension = 'total'
+    AND "day" >= $2::DATE AND "day" < $3::DATE
+GROUP BY client_type ORDER BY client_type
+`
+
+type ListLinkVisitClientTypesParams struct {
+	LinkID  int64
+	DayFrom time.Time
+	DayTo   time.Time
+}
+
+type ListLinkVisitClientTypesRow struct {
+	ClientType string
+	Clicks     int64
+}
+
+func (q *Queries) ListLinkVisitClientTypes(ctx context.Context, arg ListLinkVisitClientTypesParams) ([]ListLinkVisitClientTypesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listLinkVisitClientTypes, arg.LinkID, arg.DayFrom, arg.DayTo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListLinkVisitClientTypesRow
+	for rows.Next() {
+		var i ListLinkVisitClientTypesRow
+		if err := rows.Scan(&i.ClientType, &i.Clicks); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLinkVisitSeries = `-- name: ListLinkVisitSeries :many
+SELECT ("day"::TIMESTAMP + COALESCE(NULLIF("value", '')::INT, 0) * INTERVAL '1 hour')::TIMESTAMP AS bucket, SUM(clicks)::BIGINT AS clicks
+FROM visit_daily_stats
+WHERE link_id = $1 AND dimension = $2
+    AND "day" >= $3::DATE AND "day" < $4::DATE
+    AND ($5::BOOLEAN OR client_type <> 'bot')
+GROUP BY bucket ORDER BY bucket
+`
+
+type ListLinkVisitSeriesParams struct {
+	LinkID      int64
+	Dimension   string
+	DayFrom     time.Time
+	DayTo       time.Time
+	IncludeBots bool
+}
+
+type ListLinkVisitSeriesRow struct {
+	Bucket time.Time
+	Clicks int64
+}
+
+// The total dimension gives clicks per day, the hour one per hour
+func (q *Queries) ListLinkVisitSeries(ctx context.Context, arg ListLinkVisitSeriesParams) ([]ListLinkVisitSeriesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listLinkVisitSeries,
+		arg.LinkID,
+		arg.Dimension,
+		arg.DayFrom,
+		arg.DayTo,
+		arg.IncludeBots,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListLinkVisitSeriesRow
+	for rows.Next() {
+		var i ListLinkVisitSeriesRow
+		if err := rows.Scan(&i.Bucket, &i.Clicks); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLinkVisitStatuses = `-- name: ListLinkVisitStatuses :many
+SELECT "value"::SMALLINT AS "status", SUM(clicks)::BIGINT AS clicks
+FROM visit_daily_stats
+WHERE link_id = $1 AND dimension = 'status'
+    AND "day" >= $2::DATE AND "day" < $3::DATE
+    AND ($4::BOOLEAN OR client_type <> 'bot')
+GROUP BY "value" ORDER BY "status"
+`
+
+type ListLinkVisitStatusesParams struct {
+	LinkID      int64
+	DayFrom     time.Time
+	DayTo       time.Time
+	IncludeBots bool
+}
+
+type ListLinkVisitStatusesRow struct {
+	Status int16
+	Clicks int64
+}
+
+func (q *Queries) ListLinkVisitStatuses(ctx context.Context, arg ListLinkVisitStatusesParams) ([]ListLinkVisitStatusesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listLinkVisitStatuses,
+		arg.LinkID,
+		arg.DayFrom,
+		arg.DayTo,
+		arg.IncludeBots,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListLinkVisitStatusesRow
+	for rows.Next() {
+		var i ListLinkVisitStatusesRow
+		if err := rows.Scan(&i.Status, &i.Clicks); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,105 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: users.sql
+
+package db
+
+import (
+	"context"
+)
+
+const createUser = `-- name: CreateUser :one
+INSERT INTO users (name, workspace_id, "role") VALUES ($1, $2, $3) RETURNING id, name, created_at, workspace_id, role
+`
+
+type CreateUserParams struct {
+	Name        string
+	WorkspaceID int64
+	Role        string
+}
+
+func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, createUser, arg.Name, arg.WorkspaceID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.WorkspaceID,
+		&i.Role,
+	)
+	return i, err
+}
+
+const getUser = `-- name: GetUser :one
+SELECT id, name, created_at, workspace_id, role FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUser(ctx context.Context, id int64) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.WorkspaceID,
+		&i.Role,
+	)
+	return i, err
+}
+
+const getWorkspaceUser = `-- name: GetWorkspaceUser :one
+SELECT id, name, created_at, workspace_id, role FROM users WHERE id = $1 AND workspace_id = $2
+`
+
+type GetWorkspaceUserParams struct {
+	ID          int64
+	WorkspaceID int64
+}
+
+func (q *Queries) GetWorkspaceUser(ctx context.Context, arg GetWorkspaceUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, getWorkspaceUser, arg.ID, arg.WorkspaceID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.WorkspaceID,
+		&i.Role,
+	)
+	return i, err
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT id, name, created_at, workspace_id, role FROM users ORDER BY id
+`
+
+func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.WorkspaceID,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
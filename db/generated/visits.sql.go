@@ -8,18 +8,36 @@ package db
 import (
 	"context"
 	"database/sql"
+	"time"
 )
 
 const createVisit = `-- name: CreateVisit :one
-INSERT INTO visits (link_id, ip, user_agent, referer, "status") VALUES ($1, $2, $3, $4, $5) RETURNING id, link_id, ip, user_agent, referer, status, created_at
+INSERT INTO visits (link_id, ip, user_agent, referer, "status", client_type, browser, browser_version, os, os_version, device, country, region, city, target, variant)
+VALUES (
+    $1, $2, $3, $4, $5, COALESCE($6::VARCHAR, 'human'),
+    $7, $8, $9, $10, $11,
+    $12, $13, $14, $15, $16
+)
+RETURNING id, link_id, ip, user_agent, referer, status, created_at, client_type, browser, browser_version, os, os_version, device, country, region, city, target, variant
 `
 
 type CreateVisitParams struct {
-	LinkID    int64
-	Ip        sql.NullString
-	UserAgent sql.NullString
-	Referer   sql.NullString
-	Status    int16
+	LinkID         int64
+	Ip             sql.NullString
+	UserAgent      sql.NullString
+	Referer        sql.NullString
+	Status         int16
+	ClientType     sql.NullString
+	Browser        sql.NullString
+	BrowserVersion sql.NullString
+	Os             sql.NullString
+	OsVersion      sql.NullString
+	Device         sql.NullString
+	Country        sql.NullString
+	Region         sql.NullString
+	City           sql.NullString
+	Target         sql.NullString
+	Variant        sql.NullString
 }
 
 func (q *Queries) CreateVisit(ctx context.Context, arg CreateVisitParams) (Visit, error) {
@@ -29,6 +47,17 @@ func (q *Queries) CreateVisit(ctx context.Context, arg CreateVisitParams) (Visit
 		arg.UserAgent,
 		arg.Referer,
 		arg.Status,
+		arg.ClientType,
+		arg.Browser,
+		arg.BrowserVersion,
+		arg.Os,
+		arg.OsVersion,
+		arg.Device,
+		arg.Country,
+		arg.Region,
+		arg.City,
+		arg.Target,
+		arg.Variant,
 	)
 	var i Visit
 	err := row.Scan(
@@ -39,10 +68,62 @@ func (q *Queries) CreateVisit(ctx context.Context, arg CreateVisitParams) (Visit
 		&i.Referer,
 		&i.Status,
 		&i.CreatedAt,
+		&i.ClientType,
+		&i.Browser,
+		&i.BrowserVersion,
+		&i.Os,
+		&i.OsVersion,
+		&i.Device,
+		&i.Country,
+		&i.Region,
+		&i.City,
+		&i.Target,
+		&i.Variant,
 	)
 	return i, err
 }
 
+const deleteTrashedLinkVisitsBefore = `-- name: DeleteTrashedLinkVisitsBefore :execrows
+DELETE FROM visits WHERE id IN (
+    SELECT old.id FROM visits AS old JOIN links ON links.id = old.link_id
+    WHERE links.deleted_at < $1::TIMESTAMPTZ ORDER BY old.id LIMIT $2
+)
+`
+
+type DeleteTrashedLinkVisitsBeforeParams struct {
+	Before time.Time
+	Limit  int32
+}
+
+// Visits of links trashed before the time, purged in batches ahead of the links
+func (q *Queries) DeleteTrashedLinkVisitsBefore(ctx context.Context, arg DeleteTrashedLinkVisitsBeforeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteTrashedLinkVisitsBefore, arg.Before, arg.Limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteVisitsBefore = `-- name: DeleteVisitsBefore :execrows
+DELETE FROM visits WHERE id IN (
+    SELECT old.id FROM visits AS old WHERE old.created_at < $1::TIMESTAMPTZ ORDER BY old.id LIMIT $2
+)
+`
+
+type DeleteVisitsBeforeParams struct {
+	Before time.Time
+	Limit  int32
+}
+
+// Deletes in small batches so old visits are purged without holding long locks
+func (q *Queries) DeleteVisitsBefore(ctx context.Context, arg DeleteVisitsBeforeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteVisitsBefore, arg.Before, arg.Limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getVisitCount = `-- name: GetVisitCount :one
 SELECT COUNT(*) FROM visits
 `
@@ -54,8 +135,62 @@ func (q *Queries) GetVisitCount(ctx context.Context) (int64, error) {
 	return count, err
 }
 
+const getWorkspaceVisitCount = `-- name: GetWorkspaceVisitCount :one
+SELECT COUNT(*) FROM visits JOIN links ON links.id = visits.link_id
+WHERE links.workspace_id = $1
+    AND ($2::BIGINT IS NULL OR visits.link_id = $2)
+    AND ($3::TIMESTAMPTZ IS NULL OR visits.created_at >= $3)
+    AND ($4::TIMESTAMPTZ IS NULL OR visits.created_at < $4)
+    AND ($5::SMALLINT IS NULL OR visits."status" = $5)
+    AND ($6::TEXT IS NULL OR visits.referer ILIKE '%' || $6 || '%')
+    AND ($7::TEXT IS NULL OR visits.ip = $7)
+    AND ($8::TEXT IS NULL OR visits.client_type = $8)
+    AND ($9::BOOLEAN OR visits.client_type <> 'bot')
+    AND ($10::TEXT IS NULL OR LOWER(visits.browser) = LOWER($10))
+    AND ($11::TEXT IS NULL OR LOWER(visits.os) = LOWER($11))
+    AND ($12::TEXT IS NULL OR visits.device = $12)
+    AND ($13::TEXT IS NULL OR visits.country = UPPER($13))
+`
+
+type GetWorkspaceVisitCountParams struct {
+	WorkspaceID int64
+	LinkID      sql.NullInt64
+	CreatedFrom sql.NullTime
+	CreatedTo   sql.NullTime
+	Status      sql.NullInt16
+	Referer     sql.NullString
+	Ip          sql.NullString
+	ClientType  sql.NullString
+	IncludeBots bool
+	Browser     sql.NullString
+	Os          sql.NullString
+	Device      sql.NullString
+	Country     sql.NullString
+}
+
+func (q *Queries) GetWorkspaceVisitCount(ctx context.Context, arg GetWorkspaceVisitCountParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getWorkspaceVisitCount,
+		arg.WorkspaceID,
+		arg.LinkID,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.Status,
+		arg.Referer,
+		arg.Ip,
+		arg.ClientType,
+		arg.IncludeBots,
+		arg.Browser,
+		arg.Os,
+		arg.Device,
+		arg.Country,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const listVisits = `-- name: ListVisits :many
-SELECT id, link_id, ip, user_agent, referer, status, created_at FROM visits ORDER BY id LIMIT $1 OFFSET $2
+SELECT id, link_id, ip, user_agent, referer, status, created_at, client_type, browser, browser_version, os, os_version, device, country, region, city, target, variant FROM visits ORDER BY id LIMIT $1 OFFSET $2
 `
 
 type ListVisitsParams struct {
@@ -80,6 +215,111 @@ func (q *Queries) ListVisits(ctx context.Context, arg ListVisitsParams) ([]Visit
 			&i.Referer,
 			&i.Status,
 			&i.CreatedAt,
+			&i.ClientType,
+			&i.Browser,
+			&i.BrowserVersion,
+			&i.Os,
+			&i.OsVersion,
+			&i.Device,
+			&i.Country,
+			&i.Region,
+			&i.City,
+			&i.Target,
+			&i.Variant,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWorkspaceVisits = `-- name: ListWorkspaceVisits :many
+SELECT visits.id, visits.link_id, visits.ip, visits.user_agent, visits.referer, visits.status, visits.created_at, visits.client_type, visits.browser, visits.browser_version, visits.os, visits.os_version, visits.device, visits.country, visits.region, visits.city, visits.target, visits.variant FROM visits JOIN links ON links.id = visits.link_id
+WHERE links.workspace_id = $1
+    AND ($2::BIGINT IS NULL OR visits.link_id = $2)
+    AND ($3::TIMESTAMPTZ IS NULL OR visits.created_at >= $3)
+    AND ($4::TIMESTAMPTZ IS NULL OR visits.created_at < $4)
+    AND ($5::SMALLINT IS NULL OR visits."status" = $5)
+    AND ($6::TEXT IS NULL OR visits.referer ILIKE '%' || $6 || '%')
+    AND ($7::TEXT IS NULL OR visits.ip = $7)
+    AND ($8::TEXT IS NULL OR visits.client_type = $8)
+    AND ($9::BOOLEAN OR visits.client_type <> 'bot')
+    AND ($10::TEXT IS NULL OR LOWER(visits.browser) = LOWER($10))
+    AND ($11::TEXT IS NULL OR LOWER(visits.os) = LOWER($11))
+    AND ($12::TEXT IS NULL OR visits.device = $12)
+    AND ($13::TEXT IS NULL OR visits.country = UPPER($13))
+ORDER BY visits.id LIMIT $15 OFFSET $14
+`
+
+type ListWorkspaceVisitsParams struct {
+	WorkspaceID int64
+	LinkID      sql.NullInt64
+	CreatedFrom sql.NullTime
+	CreatedTo   sql.NullTime
+	Status      sql.NullInt16
+	Referer     sql.NullString
+	Ip          sql.NullString
+	ClientType  sql.NullString
+	IncludeBots bool
+	Browser     sql.NullString
+	Os          sql.NullString
+	Device      sql.NullString
+	Country     sql.NullString
+	Offset      int32
+	Limit       int32
+}
+
+func (q *Queries) ListWorkspaceVisits(ctx context.Context, arg ListWorkspaceVisitsParams) ([]Visit, error) {
+	rows, err := q.db.QueryContext(ctx, listWorkspaceVisits,
+		arg.WorkspaceID,
+		arg.LinkID,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.Status,
+		arg.Referer,
+		arg.Ip,
+		arg.ClientType,
+		arg.IncludeBots,
+		arg.Browser,
+		arg.Os,
+		arg.Device,
+		arg.Country,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Visit
+	for rows.Next() {
+		var i Visit
+		if err := rows.Scan(
+			&i.ID,
+			&i.LinkID,
+			&i.Ip,
+			&i.UserAgent,
+			&i.Referer,
+			&i.Status,
+			&i.CreatedAt,
+			&i.ClientType,
+			&i.Browser,
+			&i.BrowserVersion,
+			&i.Os,
+			&i.OsVersion,
+			&i.Device,
+			&i.Country,
+			&i.Region,
+			&i.City,
+			&i.Target,
+			&i.Variant,
 		); err != nil {
 			return nil, err
 		}
@@ -0,0 +1,105 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: workspaces.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+const createWorkspace = `-- name: CreateWorkspace :one
+INSERT INTO workspaces (name, domain, max_links) VALUES ($1, $2, $3) RETURNING id, name, domain, max_links, is_default, created_at
+`
+
+type CreateWorkspaceParams struct {
+	Name     string
+	Domain   sql.NullString
+	MaxLinks sql.NullInt32
+}
+
+func (q *Queries) CreateWorkspace(ctx context.Context, arg CreateWorkspaceParams) (Workspace, error) {
+	row := q.db.QueryRowContext(ctx, createWorkspace, arg.Name, arg.Domain, arg.MaxLinks)
+	var i Workspace
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Domain,
+		&i.MaxLinks,
+		&i.IsDefault,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getDefaultWorkspace = `-- name: GetDefaultWorkspace :one
+SELECT id, name, domain, max_links, is_default, created_at FROM workspaces WHERE is_default
+`
+
+func (q *Queries) GetDefaultWorkspace(ctx context.Context) (Workspace, error) {
+	row := q.db.QueryRowContext(ctx, getDefaultWorkspace)
+	var i Workspace
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Domain,
+		&i.MaxLinks,
+		&i.IsDefault,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getWorkspace = `-- name: GetWorkspace :one
+SELECT id, name, domain, max_links, is_default, created_at FROM workspaces WHERE id = $1
+`
+
+func (q *Queries) GetWorkspace(ctx context.Context, id int64) (Workspace, error) {
+	row := q.db.QueryRowContext(ctx, getWorkspace, id)
+	var i Workspace
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Domain,
+		&i.MaxLinks,
+		&i.IsDefault,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listWorkspaces = `-- name: ListWorkspaces :many
+SELECT id, name, domain, max_links, is_default, created_at FROM workspaces ORDER BY id
+`
+
+func (q *Queries) ListWorkspaces(ctx context.Context) ([]Workspace, error) {
+	rows, err := q.db.QueryContext(ctx, listWorkspaces)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Workspace
+	for rows.Next() {
+		var i Workspace
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Domain,
+			&i.MaxLinks,
+			&i.IsDefault,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE links
+    ADD COLUMN max_visits INTEGER,
+    ADD COLUMN visits_count INTEGER DEFAULT 0 NOT NULL;
+
+UPDATE links SET visits_count = counts.total
+FROM (
+    SELECT link_id, COUNT(*) AS total FROM visits WHERE "status" BETWEEN 300 AND 399 GROUP BY link_id
+) AS counts
+WHERE links.id = counts.link_id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE links
+    DROP COLUMN IF EXISTS visits_count,
+    DROP COLUMN IF EXISTS max_visits;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE users (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_users_name ON users(name);
+
+ALTER TABLE links ADD COLUMN owner_id BIGINT REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE api_keys ADD COLUMN user_id BIGINT REFERENCES users(id) ON DELETE CASCADE;
+
+-- Existing links and keys are handed over to the admin user
+INSERT INTO users (name)
+SELECT 'admin' WHERE EXISTS (SELECT 1 FROM links) OR EXISTS (SELECT 1 FROM api_keys);
+
+UPDATE links SET owner_id = (SELECT id FROM users WHERE name = 'admin');
+UPDATE api_keys SET user_id = (SELECT id FROM users WHERE name = 'admin');
+
+ALTER TABLE links ALTER COLUMN owner_id SET NOT NULL;
+ALTER TABLE api_keys ALTER COLUMN user_id SET NOT NULL;
+
+CREATE INDEX idx_links_owner_id ON links(owner_id);
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE api_keys DROP COLUMN IF EXISTS user_id;
+ALTER TABLE links DROP COLUMN IF EXISTS owner_id;
+DROP TABLE IF EXISTS users;
+-- +goose StatementEnd
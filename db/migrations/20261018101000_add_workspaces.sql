@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE workspaces (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    domain VARCHAR(255),
+    max_links INTEGER,
+    is_default BOOLEAN DEFAULT FALSE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_workspaces_name ON workspaces(name);
+CREATE UNIQUE INDEX idx_workspaces_domain ON workspaces(domain);
+CREATE UNIQUE INDEX idx_workspaces_is_default ON workspaces(is_default) WHERE is_default;
+
+-- The default workspace serves every host without its own workspace
+INSERT INTO workspaces (name, is_default) VALUES ('default', TRUE);
+
+ALTER TABLE users ADD COLUMN workspace_id BIGINT REFERENCES workspaces(id) ON DELETE CASCADE;
+ALTER TABLE links ADD COLUMN workspace_id BIGINT REFERENCES workspaces(id) ON DELETE CASCADE;
+
+UPDATE users SET workspace_id = (SELECT id FROM workspaces WHERE is_default);
+UPDATE links SET workspace_id = users.workspace_id FROM users WHERE users.id = links.owner_id;
+
+ALTER TABLE users ALTER COLUMN workspace_id SET NOT NULL;
+ALTER TABLE links ALTER COLUMN workspace_id SET NOT NULL;
+
+CREATE INDEX idx_users_workspace_id ON users(workspace_id);
+
+DROP INDEX idx_links_short_name;
+CREATE UNIQUE INDEX idx_links_workspace_id_short_name ON links(workspace_id, short_name);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_links_workspace_id_short_name;
+CREATE UNIQUE INDEX idx_links_short_name ON links(short_name);
+
+ALTER TABLE links DROP COLUMN IF EXISTS workspace_id;
+ALTER TABLE users DROP COLUMN IF EXISTS workspace_id;
+DROP TABLE IF EXISTS workspaces;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN "role" VARCHAR(16) DEFAULT 'viewer' NOT NULL
+    CHECK ("role" IN ('viewer', 'editor', 'admin'));
+
+-- Existing users had full access before roles were introduced
+UPDATE users SET "role" = 'admin';
+
+CREATE INDEX idx_links_workspace_id ON links(workspace_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_links_workspace_id;
+ALTER TABLE users DROP COLUMN IF EXISTS "role";
+-- +goose StatementEnd
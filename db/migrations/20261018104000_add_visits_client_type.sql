@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE visits ADD COLUMN client_type VARCHAR(16) DEFAULT 'human' NOT NULL
+    CHECK (client_type IN ('human', 'bot', 'suspicious'));
+
+-- Rough classification of the visits recorded before, new ones are classified by the app
+UPDATE visits SET client_type = 'bot'
+WHERE user_agent ~* '(bot|crawl|spider|slurp|facebookexternalhit|embedly|preview|whatsapp|vkshare)';
+
+UPDATE visits SET client_type = 'suspicious'
+WHERE client_type = 'human' AND (user_agent IS NULL OR user_agent ~* '(curl|wget|python|go-http-client|java|okhttp|headless)');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE visits DROP COLUMN IF EXISTS client_type;
+-- +goose StatementEnd
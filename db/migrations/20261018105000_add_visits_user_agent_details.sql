@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE visits ALTER COLUMN user_agent TYPE VARCHAR(1024);
+
+-- Parsed from the user agent when the visit is recorded, visits recorded before stay empty
+ALTER TABLE visits ADD COLUMN browser VARCHAR(64);
+ALTER TABLE visits ADD COLUMN browser_version VARCHAR(32);
+ALTER TABLE visits ADD COLUMN os VARCHAR(64);
+ALTER TABLE visits ADD COLUMN os_version VARCHAR(32);
+ALTER TABLE visits ADD COLUMN device VARCHAR(16);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE visits DROP COLUMN IF EXISTS device;
+ALTER TABLE visits DROP COLUMN IF EXISTS os_version;
+ALTER TABLE visits DROP COLUMN IF EXISTS os;
+ALTER TABLE visits DROP COLUMN IF EXISTS browser_version;
+ALTER TABLE visits DROP COLUMN IF EXISTS browser;
+ALTER TABLE visits ALTER COLUMN user_agent TYPE VARCHAR(255) USING LEFT(user_agent, 255);
+-- +goose StatementEnd
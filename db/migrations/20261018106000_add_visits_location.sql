@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE visits ADD COLUMN country VARCHAR(2);
+ALTER TABLE visits ADD COLUMN region VARCHAR(128);
+ALTER TABLE visits ADD COLUMN city VARCHAR(128);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE visits DROP COLUMN IF EXISTS city;
+ALTER TABLE visits DROP COLUMN IF EXISTS region;
+ALTER TABLE visits DROP COLUMN IF EXISTS country;
+-- +goose StatementEnd
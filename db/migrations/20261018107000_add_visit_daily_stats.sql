@@ -0,0 +1,70 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Clicks per link, UTC day and client type broken down by dimension:
+-- total, hour, status, country, city (country/city), referer (domain), user_agent and visitor (ip hash, for unique visitors)
+CREATE TABLE visit_daily_stats (
+    link_id BIGINT REFERENCES links(id) ON DELETE CASCADE NOT NULL,
+    "day" DATE NOT NULL,
+    client_type VARCHAR(16) NOT NULL,
+    dimension VARCHAR(16) NOT NULL,
+    "value" VARCHAR(255) NOT NULL,
+    clicks BIGINT NOT NULL,
+    PRIMARY KEY (link_id, dimension, "day", client_type, "value")
+);
+
+CREATE FUNCTION rollup_visits() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO visit_daily_stats (link_id, "day", client_type, dimension, "value", clicks)
+    SELECT link_id, "day", client_type, dimension, "value", COUNT(*) FROM (
+        SELECT new_visits.link_id, (new_visits.created_at AT TIME ZONE 'UTC')::DATE AS "day", new_visits.client_type, d.dimension, d.value
+        FROM new_visits
+        CROSS JOIN LATERAL (VALUES
+            ('total', ''),
+            ('hour', to_char(new_visits.created_at AT TIME ZONE 'UTC', 'HH24')),
+            ('status', new_visits.status::TEXT),
+            ('country', COALESCE(new_visits.country, '')),
+            ('city', COALESCE(new_visits.country, '') || '/' || LEFT(new_visits.city, 128)),
+            ('referer', COALESCE(LEFT(LOWER(substring(new_visits.referer FROM '^[a-zA-Z][a-zA-Z0-9+.-]*://([^/?#:]+)')), 255), '')),
+            ('user_agent', COALESCE(LEFT(new_visits.user_agent, 255), '')),
+            ('visitor', md5(new_visits.ip))
+        ) AS d(dimension, "value")
+        WHERE d.value IS NOT NULL
+    ) AS rows
+    GROUP BY link_id, "day", client_type, dimension, "value"
+    ON CONFLICT (link_id, dimension, "day", client_type, "value") DO UPDATE SET clicks = visit_daily_stats.clicks + EXCLUDED.clicks;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Statement level, so a batch of visits written with COPY is rolled up at once
+CREATE TRIGGER visits_rollup AFTER INSERT ON visits
+    REFERENCING NEW TABLE AS new_visits
+    FOR EACH STATEMENT EXECUTE FUNCTION rollup_visits();
+
+-- Existing visits
+INSERT INTO visit_daily_stats (link_id, "day", client_type, dimension, "value", clicks)
+SELECT link_id, "day", client_type, dimension, "value", COUNT(*) FROM (
+    SELECT visits.link_id, (visits.created_at AT TIME ZONE 'UTC')::DATE AS "day", visits.client_type, d.dimension, d.value
+    FROM visits
+    CROSS JOIN LATERAL (VALUES
+        ('total', ''),
+        ('hour', to_char(visits.created_at AT TIME ZONE 'UTC', 'HH24')),
+        ('status', visits.status::TEXT),
+        ('country', COALESCE(visits.country, '')),
+        ('city', COALESCE(visits.country, '') || '/' || LEFT(visits.city, 128)),
+        ('referer', COALESCE(LEFT(LOWER(substring(visits.referer FROM '^[a-zA-Z][a-zA-Z0-9+.-]*://([^/?#:]+)')), 255), '')),
+        ('user_agent', COALESCE(LEFT(visits.user_agent, 255), '')),
+        ('visitor', md5(visits.ip))
+    ) AS d(dimension, "value")
+    WHERE d.value IS NOT NULL
+) AS rows
+GROUP BY link_id, "day", client_type, dimension, "value";
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS visits_rollup ON visits;
+DROP FUNCTION IF EXISTS rollup_visits();
+DROP TABLE IF EXISTS visit_daily_stats;
+-- +goose StatementEnd
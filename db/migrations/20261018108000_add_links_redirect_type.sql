@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- NULL follows the server default
+ALTER TABLE links
+    ADD COLUMN redirect_type SMALLINT CHECK (redirect_type IN (301, 302, 307, 308));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE links
+    DROP COLUMN IF EXISTS redirect_type;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE links
+    ADD COLUMN forward_query BOOLEAN DEFAULT false NOT NULL,
+    ADD COLUMN forward_path BOOLEAN DEFAULT false NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE links
+    DROP COLUMN IF EXISTS forward_path,
+    DROP COLUMN IF EXISTS forward_query;
+-- +goose StatementEnd
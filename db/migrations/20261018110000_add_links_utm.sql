@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Merged into the query of original_url on redirect
+ALTER TABLE links
+    ADD COLUMN utm_source VARCHAR(255),
+    ADD COLUMN utm_medium VARCHAR(255),
+    ADD COLUMN utm_campaign VARCHAR(255),
+    ADD COLUMN utm_term VARCHAR(255),
+    ADD COLUMN utm_content VARCHAR(255);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE links
+    DROP COLUMN IF EXISTS utm_content,
+    DROP COLUMN IF EXISTS utm_term,
+    DROP COLUMN IF EXISTS utm_campaign,
+    DROP COLUMN IF EXISTS utm_medium,
+    DROP COLUMN IF EXISTS utm_source;
+-- +goose StatementEnd
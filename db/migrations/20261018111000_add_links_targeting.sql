@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Destinations by device and user agent, see internal/targeting
+ALTER TABLE links
+    ADD COLUMN targeting JSONB DEFAULT '{}' NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE links
+    DROP COLUMN IF EXISTS targeting;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Targeting rule the visit was redirected by, NULL for the original url
+ALTER TABLE visits ADD COLUMN target VARCHAR(64);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE visits DROP COLUMN IF EXISTS target;
+-- +goose StatementEnd
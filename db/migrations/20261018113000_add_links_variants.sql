@@ -0,0 +1,73 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Weighted destinations, see internal/variant
+ALTER TABLE links
+    ADD COLUMN variants JSONB DEFAULT '[]' NOT NULL,
+    ADD COLUMN sticky_variants BOOLEAN DEFAULT false NOT NULL;
+
+-- Variant the visit was redirected to
+ALTER TABLE visits ADD COLUMN variant VARCHAR(32);
+
+-- Clicks per variant are rolled up too
+CREATE OR REPLACE FUNCTION rollup_visits() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO visit_daily_stats (link_id, "day", client_type, dimension, "value", clicks)
+    SELECT link_id, "day", client_type, dimension, "value", COUNT(*) FROM (
+        SELECT new_visits.link_id, (new_visits.created_at AT TIME ZONE 'UTC')::DATE AS "day", new_visits.client_type, d.dimension, d.value
+        FROM new_visits
+        CROSS JOIN LATERAL (VALUES
+            ('total', ''),
+            ('hour', to_char(new_visits.created_at AT TIME ZONE 'UTC', 'HH24')),
+            ('status', new_visits.status::TEXT),
+            ('country', COALESCE(new_visits.country, '')),
+            ('city', COALESCE(new_visits.country, '') || '/' || LEFT(new_visits.city, 128)),
+            ('referer', COALESCE(LEFT(LOWER(substring(new_visits.referer FROM '^[a-zA-Z][a-zA-Z0-9+.-]*://([^/?#:]+)')), 255), '')),
+            ('user_agent', COALESCE(LEFT(new_visits.user_agent, 255), '')),
+            ('visitor', md5(new_visits.ip)),
+            ('variant', new_visits.variant)
+        ) AS d(dimension, "value")
+        WHERE d.value IS NOT NULL
+    ) AS rows
+    GROUP BY link_id, "day", client_type, dimension, "value"
+    ON CONFLICT (link_id, dimension, "day", client_type, "value") DO UPDATE SET clicks = visit_daily_stats.clicks + EXCLUDED.clicks;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION rollup_visits() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO visit_daily_stats (link_id, "day", client_type, dimension, "value", clicks)
+    SELECT link_id, "day", client_type, dimension, "value", COUNT(*) FROM (
+        SELECT new_visits.link_id, (new_visits.created_at AT TIME ZONE 'UTC')::DATE AS "day", new_visits.client_type, d.dimension, d.value
+        FROM new_visits
+        CROSS JOIN LATERAL (VALUES
+            ('total', ''),
+            ('hour', to_char(new_visits.created_at AT TIME ZONE 'UTC', 'HH24')),
+            ('status', new_visits.status::TEXT),
+            ('country', COALESCE(new_visits.country, '')),
+            ('city', COALESCE(new_visits.country, '') || '/' || LEFT(new_visits.city, 128)),
+            ('referer', COALESCE(LEFT(LOWER(substring(new_visits.referer FROM '^[a-zA-Z][a-zA-Z0-9+.-]*://([^/?#:]+)')), 255), '')),
+            ('user_agent', COALESCE(LEFT(new_visits.user_agent, 255), '')),
+            ('visitor', md5(new_visits.ip))
+        ) AS d(dimension, "value")
+        WHERE d.value IS NOT NULL
+    ) AS rows
+    GROUP BY link_id, "day", client_type, dimension, "value"
+    ON CONFLICT (link_id, dimension, "day", client_type, "value") DO UPDATE SET clicks = visit_daily_stats.clicks + EXCLUDED.clicks;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DELETE FROM visit_daily_stats WHERE dimension = 'variant';
+
+ALTER TABLE visits DROP COLUMN IF EXISTS variant;
+
+ALTER TABLE links
+    DROP COLUMN IF EXISTS sticky_variants,
+    DROP COLUMN IF EXISTS variants;
+-- +goose StatementEnd
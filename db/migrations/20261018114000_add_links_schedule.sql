@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Time windows with their own destination, see internal/schedule
+ALTER TABLE links
+    ADD COLUMN schedule JSONB DEFAULT '[]' NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE links
+    DROP COLUMN IF EXISTS schedule;
+-- +goose StatementEnd
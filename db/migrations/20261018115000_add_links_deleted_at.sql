@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Deleted links stay in the trash, with their visits, until they are purged
+ALTER TABLE links ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_links_deleted_at ON links(deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_links_deleted_at;
+
+ALTER TABLE links DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,60 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Rows are upserted in the order of the conflict key, so concurrent batches lock the shared rows in the same order
+-- and wait for each other instead of deadlocking. Deadlocks that still happen are retried by the visit recorder
+CREATE OR REPLACE FUNCTION rollup_visits() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO visit_daily_stats (link_id, "day", client_type, dimension, "value", clicks)
+    SELECT link_id, "day", client_type, dimension, "value", COUNT(*) FROM (
+        SELECT new_visits.link_id, (new_visits.created_at AT TIME ZONE 'UTC')::DATE AS "day", new_visits.client_type, d.dimension, d.value
+        FROM new_visits
+        CROSS JOIN LATERAL (VALUES
+            ('total', ''),
+            ('hour', to_char(new_visits.created_at AT TIME ZONE 'UTC', 'HH24')),
+            ('status', new_visits.status::TEXT),
+            ('country', COALESCE(new_visits.country, '')),
+            ('city', COALESCE(new_visits.country, '') || '/' || LEFT(new_visits.city, 128)),
+            ('referer', COALESCE(LEFT(LOWER(substring(new_visits.referer FROM '^[a-zA-Z][a-zA-Z0-9+.-]*://([^/?#:]+)')), 255), '')),
+            ('user_agent', COALESCE(LEFT(new_visits.user_agent, 255), '')),
+            ('visitor', md5(new_visits.ip)),
+            ('variant', new_visits.variant)
+        ) AS d(dimension, "value")
+        WHERE d.value IS NOT NULL
+    ) AS rows
+    GROUP BY link_id, "day", client_type, dimension, "value"
+    ORDER BY link_id, dimension, "day", client_type, "value"
+    ON CONFLICT (link_id, dimension, "day", client_type, "value") DO UPDATE SET clicks = visit_daily_stats.clicks + EXCLUDED.clicks;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION rollup_visits() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO visit_daily_stats (link_id, "day", client_type, dimension, "value", clicks)
+    SELECT link_id, "day", client_type, dimension, "value", COUNT(*) FROM (
+        SELECT new_visits.link_id, (new_visits.created_at AT TIME ZONE 'UTC')::DATE AS "day", new_visits.client_type, d.dimension, d.value
+        FROM new_visits
+        CROSS JOIN LATERAL (VALUES
+            ('total', ''),
+            ('hour', to_char(new_visits.created_at AT TIME ZONE 'UTC', 'HH24')),
+            ('status', new_visits.status::TEXT),
+            ('country', COALESCE(new_visits.country, '')),
+            ('city', COALESCE(new_visits.country, '') || '/' || LEFT(new_visits.city, 128)),
+            ('referer', COALESCE(LEFT(LOWER(substring(new_visits.referer FROM '^[a-zA-Z][a-zA-Z0-9+.-]*://([^/?#:]+)')), 255), '')),
+            ('user_agent', COALESCE(LEFT(new_visits.user_agent, 255), '')),
+            ('visitor', md5(new_visits.ip)),
+            ('variant', new_visits.variant)
+        ) AS d(dimension, "value")
+        WHERE d.value IS NOT NULL
+    ) AS rows
+    GROUP BY link_id, "day", client_type, dimension, "value"
+    ON CONFLICT (link_id, dimension, "day", client_type, "value") DO UPDATE SET clicks = visit_daily_stats.clicks + EXCLUDED.clicks;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
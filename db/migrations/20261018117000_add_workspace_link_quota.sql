@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Links are counted with the workspace row locked, so concurrent creates and restores can't go past max_links.
+-- Every query of the function sees a fresh snapshot, the count includes links committed while waiting for the lock
+CREATE FUNCTION check_workspace_link_quota() RETURNS TRIGGER AS $$
+DECLARE
+    quota INTEGER;
+BEGIN
+    SELECT max_links INTO quota FROM workspaces WHERE id = NEW.workspace_id;
+    IF quota IS NULL THEN
+        RETURN NEW;
+    END IF;
+
+    SELECT max_links INTO quota FROM workspaces WHERE id = NEW.workspace_id FOR UPDATE;
+
+    IF (SELECT COUNT(*) FROM links WHERE workspace_id = NEW.workspace_id AND deleted_at IS NULL) >= quota THEN
+        RAISE EXCEPTION 'workspace link quota exceeded'
+            USING ERRCODE = 'check_violation', CONSTRAINT = 'workspace_link_quota';
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER links_workspace_link_quota BEFORE INSERT ON links
+FOR EACH ROW WHEN (NEW.deleted_at IS NULL) EXECUTE FUNCTION check_workspace_link_quota();
+
+-- Restored links count again
+CREATE TRIGGER links_workspace_link_quota_restore BEFORE UPDATE OF deleted_at ON links
+FOR EACH ROW WHEN (OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL) EXECUTE FUNCTION check_workspace_link_quota();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS links_workspace_link_quota_restore ON links;
+DROP TRIGGER IF EXISTS links_workspace_link_quota ON links;
+DROP FUNCTION IF EXISTS check_workspace_link_quota();
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- name: ListApiKeys :many
+SELECT * FROM api_keys ORDER BY id;
+
+-- name: CreateApiKey :one
+INSERT INTO api_keys (name, prefix, key_hash, user_id) VALUES ($1, $2, $3, $4) RETURNING *;
+
+-- name: GetActiveApiKeyByHash :one
+SELECT sqlc.embed(api_keys), sqlc.embed(users), sqlc.embed(workspaces) FROM api_keys
+JOIN users ON users.id = api_keys.user_id
+JOIN workspaces ON workspaces.id = users.workspace_id
+WHERE api_keys.key_hash = $1 AND api_keys.revoked_at IS NULL;
+
+-- name: RevokeApiKey :one
+UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL RETURNING *;
+
+-- name: ListWorkspaceApiKeys :many
+SELECT api_keys.* FROM api_keys JOIN users ON users.id = api_keys.user_id WHERE users.workspace_id = $1 ORDER BY api_keys.id;
+
+-- name: RevokeWorkspaceApiKey :one
+UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP
+WHERE api_keys.id = $1 AND api_keys.revoked_at IS NULL
+    AND api_keys.user_id IN (SELECT users.id FROM users WHERE users.workspace_id = $2)
+RETURNING *;
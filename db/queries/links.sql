@@ -1,20 +1,64 @@
 -- name: GetLinkCount :one
-SELECT COUNT(*) FROM links;
+-- Lists either the links in use or the trashed ones
+SELECT COUNT(*) FROM links WHERE workspace_id = sqlc.arg(workspace_id) AND (deleted_at IS NOT NULL) = sqlc.arg(trashed)::BOOLEAN;
 
 -- name: ListLinks :many
-SELECT * FROM links ORDER BY id LIMIT $1 OFFSET $2;
+SELECT * FROM links WHERE workspace_id = sqlc.arg(workspace_id) AND (deleted_at IS NOT NULL) = sqlc.arg(trashed)::BOOLEAN
+ORDER BY id LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
 
 -- name: CreateLink :one
-INSERT INTO links (original_url, short_name) VALUES ($1, $2) RETURNING *;
+INSERT INTO links (
+    original_url, short_name, expires_at, expired_url, max_visits, password_hash, redirect_type, forward_query, forward_path,
+    utm_source, utm_medium, utm_campaign, utm_term, utm_content, targeting, variants, sticky_variants, schedule, owner_id, workspace_id
+)
+VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, (SELECT workspace_id FROM users WHERE users.id = $19)
+) RETURNING *;
 
 -- name: GetLink :one
 SELECT * FROM links WHERE id = $1;
 
+-- name: GetWorkspaceLink :one
+SELECT * FROM links WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NULL;
+
+-- name: GetOwnedLink :one
+-- Editors only change links of their own
+SELECT * FROM links WHERE id = $1 AND owner_id = $2 AND deleted_at IS NULL;
+
 -- name: GetLinkByShortName :one
-SELECT * FROM links WHERE short_name = $1;
+-- Links are looked up in the workspace bound to the request domain, falling back to the default one.
+-- Trashed links are found too, redirects answer them with 410 Gone
+SELECT links.* FROM links
+WHERE links.short_name = $1 AND links.workspace_id = (
+    SELECT workspaces.id FROM workspaces WHERE workspaces.domain = $2 OR workspaces.is_default ORDER BY workspaces.is_default LIMIT 1
+);
 
 -- name: UpdateLink :one
-UPDATE links SET original_url = $1, short_name = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3 RETURNING *;
+-- visits_count is only kept up to date for links with max_visits, a new limit counts the redirects made so far
+UPDATE links SET
+    visits_count = CASE WHEN max_visits IS NULL AND $5::INTEGER IS NOT NULL THEN (
+        SELECT COUNT(*) FROM visits WHERE visits.link_id = links.id AND visits."status" BETWEEN 300 AND 399 AND visits.client_type <> 'bot'
+    ) ELSE visits_count END,
+    original_url = $1, short_name = $2, expires_at = $3, expired_url = $4, max_visits = $5, password_hash = $6, redirect_type = $7,
+    forward_query = $8, forward_path = $9, utm_source = $10, utm_medium = $11, utm_campaign = $12, utm_term = $13, utm_content = $14,
+    targeting = $15, variants = $16, sticky_variants = $17, schedule = $18, updated_at = CURRENT_TIMESTAMP
+WHERE links.id = $19 AND links.owner_id = $20 AND links.deleted_at IS NULL RETURNING *;
+
+-- name: TrashLink :exec
+UPDATE links SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NULL;
+
+-- name: RestoreLink :one
+UPDATE links SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NOT NULL RETURNING *;
+
+-- name: DeleteTrashedLinksBefore :execrows
+-- Visits and rollups of the links are purged first, see retention.PurgeLinks
+DELETE FROM links WHERE id IN (
+    SELECT old.id FROM links AS old WHERE old.deleted_at < sqlc.arg(before)::TIMESTAMPTZ ORDER BY old.id LIMIT sqlc.arg('limit')
+);
+
+-- name: ConsumeLinkVisit :one
+UPDATE links SET visits_count = visits_count + 1 WHERE id = $1 AND visits_count < max_visits RETURNING visits_count;
 
--- name: DeleteLink :exec
-DELETE FROM links WHERE id = $1;
+-- name: PeekLinkVisit :one
+-- Like ConsumeLinkVisit without using the visit up
+SELECT visits_count FROM links WHERE id = $1 AND visits_count < max_visits;
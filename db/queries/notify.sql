@@ -0,0 +1,2 @@
+-- name: Notify :exec
+SELECT pg_notify(sqlc.arg(channel)::TEXT, sqlc.arg(payload)::TEXT);
@@ -0,0 +1,59 @@
+-- Stats are read from the daily rollups only, windows are whole UTC days
+
+-- name: GetLinkVisitTotals :one
+SELECT
+    COALESCE(SUM(clicks) FILTER (WHERE dimension = 'total'), 0)::BIGINT AS total_clicks,
+    COUNT(DISTINCT "value") FILTER (WHERE dimension = 'visitor') AS unique_visitors
+FROM visit_daily_stats
+WHERE link_id = sqlc.arg(link_id) AND dimension IN ('total', 'visitor')
+    AND "day" >= sqlc.arg(day_from)::DATE AND "day" < sqlc.arg(day_to)::DATE
+    AND (sqlc.arg(include_bots)::BOOLEAN OR client_type <> 'bot');
+
+-- name: ListLinkVisitSeries :many
+-- The total dimension gives clicks per day, the hour one per hour
+SELECT ("day"::TIMESTAMP + COALESCE(NULLIF("value", '')::INT, 0) * INTERVAL '1 hour')::TIMESTAMP AS bucket, SUM(clicks)::BIGINT AS clicks
+FROM visit_daily_stats
+WHERE link_id = sqlc.arg(link_id) AND dimension = sqlc.arg(dimension)
+    AND "day" >= sqlc.arg(day_from)::DATE AND "day" < sqlc.arg(day_to)::DATE
+    AND (sqlc.arg(include_bots)::BOOLEAN OR client_type <> 'bot')
+GROUP BY bucket ORDER BY bucket;
+
+-- name: ListLinkTopValues :many
+SELECT "value", SUM(clicks)::BIGINT AS clicks
+FROM visit_daily_stats
+WHERE link_id = sqlc.arg(link_id) AND dimension = sqlc.arg(dimension)
+    AND "day" >= sqlc.arg(day_from)::DATE AND "day" < sqlc.arg(day_to)::DATE
+    AND (sqlc.arg(include_bots)::BOOLEAN OR client_type <> 'bot')
+GROUP BY "value" ORDER BY clicks DESC, "value" LIMIT sqlc.arg('limit');
+
+-- name: ListLinkVisitStatuses :many
+SELECT "value"::SMALLINT AS "status", SUM(clicks)::BIGINT AS clicks
+FROM visit_daily_stats
+WHERE link_id = sqlc.arg(link_id) AND dimension = 'status'
+    AND "day" >= sqlc.arg(day_from)::DATE AND "day" < sqlc.arg(day_to)::DATE
+    AND (sqlc.arg(include_bots)::BOOLEAN OR client_type <> 'bot')
+GROUP BY "value" ORDER BY "status";
+
+-- name: ListLinkVisitClientTypes :many
+SELECT client_type, SUM(clicks)::BIGINT AS clicks
+FROM visit_daily_stats
+WHERE link_id = sqlc.arg(link_id) AND dimension = 'total'
+    AND "day" >= sqlc.arg(day_from)::DATE AND "day" < sqlc.arg(day_to)::DATE
+GROUP BY client_type ORDER BY client_type;
+
+-- name: DeleteVisitorStatsBefore :execrows
+-- Visitor hashes are personal data and follow the visits retention, the other dimensions are kept
+DELETE FROM visit_daily_stats WHERE (link_id, dimension, "day", client_type, "value") IN (
+    SELECT old.link_id, old.dimension, old.day, old.client_type, old.value FROM visit_daily_stats AS old
+    WHERE old.dimension = 'visitor' AND old.day < sqlc.arg(before)::DATE
+    LIMIT sqlc.arg('limit')
+);
+
+-- name: DeleteTrashedLinkStatsBefore :execrows
+-- Rollups of links trashed before the time, purged in batches ahead of the links
+DELETE FROM visit_daily_stats WHERE (link_id, dimension, "day", client_type, "value") IN (
+    SELECT old.link_id, old.dimension, old.day, old.client_type, old.value FROM visit_daily_stats AS old
+    JOIN links ON links.id = old.link_id
+    WHERE links.deleted_at < sqlc.arg(before)::TIMESTAMPTZ
+    LIMIT sqlc.arg('limit')
+);
@@ -0,0 +1,11 @@
+-- name: ListUsers :many
+SELECT * FROM users ORDER BY id;
+
+-- name: CreateUser :one
+INSERT INTO users (name, workspace_id, "role") VALUES ($1, $2, $3) RETURNING *;
+
+-- name: GetUser :one
+SELECT * FROM users WHERE id = $1;
+
+-- name: GetWorkspaceUser :one
+SELECT * FROM users WHERE id = $1 AND workspace_id = $2;
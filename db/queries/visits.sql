@@ -4,5 +4,57 @@ SELECT COUNT(*) FROM visits;
 -- name: ListVisits :many
 SELECT * FROM visits ORDER BY id LIMIT $1 OFFSET $2;
 
+-- name: GetWorkspaceVisitCount :one
+SELECT COUNT(*) FROM visits JOIN links ON links.id = visits.link_id
+WHERE links.workspace_id = sqlc.arg(workspace_id)
+    AND (sqlc.narg(link_id)::BIGINT IS NULL OR visits.link_id = sqlc.narg(link_id))
+    AND (sqlc.narg(created_from)::TIMESTAMPTZ IS NULL OR visits.created_at >= sqlc.narg(created_from))
+    AND (sqlc.narg(created_to)::TIMESTAMPTZ IS NULL OR visits.created_at < sqlc.narg(created_to))
+    AND (sqlc.narg(status)::SMALLINT IS NULL OR visits."status" = sqlc.narg(status))
+    AND (sqlc.narg(referer)::TEXT IS NULL OR visits.referer ILIKE '%' || sqlc.narg(referer) || '%')
+    AND (sqlc.narg(ip)::TEXT IS NULL OR visits.ip = sqlc.narg(ip))
+    AND (sqlc.narg(client_type)::TEXT IS NULL OR visits.client_type = sqlc.narg(client_type))
+    AND (sqlc.arg(include_bots)::BOOLEAN OR visits.client_type <> 'bot')
+    AND (sqlc.narg(browser)::TEXT IS NULL OR LOWER(visits.browser) = LOWER(sqlc.narg(browser)))
+    AND (sqlc.narg(os)::TEXT IS NULL OR LOWER(visits.os) = LOWER(sqlc.narg(os)))
+    AND (sqlc.narg(device)::TEXT IS NULL OR visits.device = sqlc.narg(device))
+    AND (sqlc.narg(country)::TEXT IS NULL OR visits.country = UPPER(sqlc.narg(country)));
+
+-- name: ListWorkspaceVisits :many
+SELECT visits.* FROM visits JOIN links ON links.id = visits.link_id
+WHERE links.workspace_id = sqlc.arg(workspace_id)
+    AND (sqlc.narg(link_id)::BIGINT IS NULL OR visits.link_id = sqlc.narg(link_id))
+    AND (sqlc.narg(created_from)::TIMESTAMPTZ IS NULL OR visits.created_at >= sqlc.narg(created_from))
+    AND (sqlc.narg(created_to)::TIMESTAMPTZ IS NULL OR visits.created_at < sqlc.narg(created_to))
+    AND (sqlc.narg(status)::SMALLINT IS NULL OR visits."status" = sqlc.narg(status))
+    AND (sqlc.narg(referer)::TEXT IS NULL OR visits.referer ILIKE '%' || sqlc.narg(referer) || '%')
+    AND (sqlc.narg(ip)::TEXT IS NULL OR visits.ip = sqlc.narg(ip))
+    AND (sqlc.narg(client_type)::TEXT IS NULL OR visits.client_type = sqlc.narg(client_type))
+    AND (sqlc.arg(include_bots)::BOOLEAN OR visits.client_type <> 'bot')
+    AND (sqlc.narg(browser)::TEXT IS NULL OR LOWER(visits.browser) = LOWER(sqlc.narg(browser)))
+    AND (sqlc.narg(os)::TEXT IS NULL OR LOWER(visits.os) = LOWER(sqlc.narg(os)))
+    AND (sqlc.narg(device)::TEXT IS NULL OR visits.device = sqlc.narg(device))
+    AND (sqlc.narg(country)::TEXT IS NULL OR visits.country = UPPER(sqlc.narg(country)))
+ORDER BY visits.id LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
 -- name: CreateVisit :one
-INSERT INTO visits (link_id, ip, user_agent, referer, "status") VALUES ($1, $2, $3, $4, $5) RETURNING *;
+INSERT INTO visits (link_id, ip, user_agent, referer, "status", client_type, browser, browser_version, os, os_version, device, country, region, city, target, variant)
+VALUES (
+    sqlc.arg(link_id), sqlc.arg(ip), sqlc.arg(user_agent), sqlc.arg(referer), sqlc.arg(status), COALESCE(sqlc.narg(client_type)::VARCHAR, 'human'),
+    sqlc.narg(browser), sqlc.narg(browser_version), sqlc.narg(os), sqlc.narg(os_version), sqlc.narg(device),
+    sqlc.narg(country), sqlc.narg(region), sqlc.narg(city), sqlc.narg(target), sqlc.narg(variant)
+)
+RETURNING *;
+
+-- name: DeleteVisitsBefore :execrows
+-- Deletes in small batches so old visits are purged without holding long locks
+DELETE FROM visits WHERE id IN (
+    SELECT old.id FROM visits AS old WHERE old.created_at < sqlc.arg(before)::TIMESTAMPTZ ORDER BY old.id LIMIT sqlc.arg('limit')
+);
+
+-- name: DeleteTrashedLinkVisitsBefore :execrows
+-- Visits of links trashed before the time, purged in batches ahead of the links
+DELETE FROM visits WHERE id IN (
+    SELECT old.id FROM visits AS old JOIN links ON links.id = old.link_id
+    WHERE links.deleted_at < sqlc.arg(before)::TIMESTAMPTZ ORDER BY old.id LIMIT sqlc.arg('limit')
+);
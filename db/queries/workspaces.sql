@@ -0,0 +1,11 @@
+-- name: ListWorkspaces :many
+SELECT * FROM workspaces ORDER BY id;
+
+-- name: CreateWorkspace :one
+INSERT INTO workspaces (name, domain, max_links) VALUES ($1, $2, $3) RETURNING *;
+
+-- name: GetWorkspace :one
+SELECT * FROM workspaces WHERE id = $1;
+
+-- name: GetDefaultWorkspace :one
+SELECT * FROM workspaces WHERE is_default;
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/darkartx/go-project-278/internal"
+	"github.com/gin-gonic/gin"
+
+	db "github.com/darkartx/go-project-278/db/generated"
+)
+
+type ApiKeyHandler struct {
+	queries *db.Queries
+}
+
+func NewApiKeyHandler(queries *db.Queries) *ApiKeyHandler {
+	return &ApiKeyHandler{queries: queries}
+}
+
+func (h *ApiKeyHandler) Register(rg *gin.RouterGroup) {
+	rg.Use(RequireRole(RoleAdmin))
+	rg.GET("", h.List)
+	rg.POST("", h.Create)
+	rg.DELETE("/:id", h.Delete)
+}
+
+func (h *ApiKeyHandler) List(c *gin.Context) {
+	apiKeys, err := h.queries.ListWorkspaceApiKeys(c, currentWorkspace(c).ID)
+	if err != nil {
+		handleDbError(err, c)
+		return
+	}
+
+	result := make([]ApiKey, 0, len(apiKeys))
+
+	for _, item := range apiKeys {
+		result = append(result, makeApiKey(item))
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *ApiKeyHandler) Create(c *gin.Context) {
+	input, err := parseAndValidateParams[ApiKeyParams](c)
+
+	if err != nil {
+		handleParseAndValidationError(err, c)
+		return
+	}
+
+	user, err := h.queries.GetWorkspaceUser(c, db.GetWorkspaceUserParams{
+		ID:          int64(input.UserId),
+		WorkspaceID: currentWorkspace(c).ID,
+	})
+	if err != nil {
+		handleDbError(err, c)
+		return
+	}
+
+	key, err := internal.GenerateApiKey()
+	if err != nil {
+		sendServerError(c)
+		return
+	}
+
+	apiKey, err := h.queries.CreateApiKey(c, db.CreateApiKeyParams{
+		Name:    input.Name,
+		Prefix:  key[:internal.ApiKeyPrefixLen],
+		KeyHash: internal.HashApiKey(key),
+		UserID:  user.ID,
+	})
+	if err != nil {
+		handleDbError(err, c)
+		return
+	}
+
+	// The key itself is only returned once, the database keeps its hash
+	result := makeApiKey(apiKey)
+	result.Key = key
+
+	c.JSON(http.StatusCreated, result)
+}
+
+func (h *ApiKeyHandler) Delete(c *gin.Context) {
+	id, err := parseId(c)
+
+	if err != nil {
+		sendError(http.StatusBadRequest, err, c)
+		return
+	}
+
+	_, err = h.queries.RevokeWorkspaceApiKey(c, db.RevokeWorkspaceApiKeyParams{
+		ID:          int64(id),
+		WorkspaceID: currentWorkspace(c).ID,
+	})
+	if err != nil {
+		handleDbError(err, c)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func makeApiKey(apiKey db.ApiKey) ApiKey {
+	result := ApiKey{
+		Id:        uint64(apiKey.ID),
+		Name:      apiKey.Name,
+		UserId:    uint64(apiKey.UserID),
+		Prefix:    apiKey.Prefix,
+		CreatedAt: apiKey.CreatedAt,
+	}
+
+	if apiKey.RevokedAt.Valid {
+		result.RevokedAt = &apiKey.RevokedAt.Time
+	}
+
+	return result
+}
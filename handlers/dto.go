@@ -3,15 +3,82 @@ package handlers
 import "time"
 
 type Link struct {
-	Id          uint64 `json:"id"`
-	OriginalUrl string `json:"original_url"`
-	ShortName   string `json:"short_name"`
-	ShortUrl    string `json:"short_url"`
+	Id              uint64              `json:"id"`
+	OriginalUrl     string              `json:"original_url"`
+	ShortName       string              `json:"short_name"`
+	ShortUrl        string              `json:"short_url"`
+	OwnerId         uint64              `json:"owner_id"`
+	ExpiresAt       *time.Time          `json:"expires_at,omitempty"`
+	ExpiredUrl      string              `json:"expired_url,omitempty"`
+	MaxVisits       *int32              `json:"max_visits,omitempty"`
+	RemainingVisits *int32              `json:"remaining_visits,omitempty"`
+	HasPassword     bool                `json:"has_password"`
+	RedirectType    *int16              `json:"redirect_type,omitempty"`
+	ForwardQuery    bool                `json:"forward_query"`
+	ForwardPath     bool                `json:"forward_path"`
+	Utm             *LinkUtm            `json:"utm,omitempty"`
+	Targeting       *LinkTargeting      `json:"targeting,omitempty"`
+	Variants        []LinkVariant       `json:"variants,omitempty"`
+	StickyVariants  bool                `json:"sticky_variants"`
+	Schedule        []LinkScheduleEntry `json:"schedule,omitempty"`
+	DeletedAt       *time.Time          `json:"deleted_at,omitempty"`
 }
 
 type LinkParams struct {
-	OriginalUrl string `json:"original_url" binding:"required,url"`
-	ShortName   string `json:"short_name,omitempty" binding:"omitempty,min=3,max=32"`
+	OriginalUrl string     `json:"original_url" binding:"required,url"`
+	ShortName   string     `json:"short_name,omitempty" binding:"omitempty,min=3,max=32"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	ExpiredUrl  string     `json:"expired_url,omitempty" binding:"omitempty,url"`
+	MaxVisits   *int32     `json:"max_visits,omitempty" binding:"omitempty,min=1"`
+	Password    *string    `json:"password,omitempty" binding:"omitempty,max=72"`
+	// Empty follows the server default
+	RedirectType *int16         `json:"redirect_type,omitempty" binding:"omitempty,oneof=301 302 307 308"`
+	ForwardQuery bool           `json:"forward_query,omitempty"`
+	ForwardPath  bool           `json:"forward_path,omitempty"`
+	Utm          *LinkUtm       `json:"utm,omitempty"`
+	Targeting    *LinkTargeting `json:"targeting,omitempty"`
+	Variants     []LinkVariant  `json:"variants,omitempty" binding:"omitempty,max=10,dive"`
+	// Returning visitors get the same variant, remembered with a cookie
+	StickyVariants bool                `json:"sticky_variants,omitempty"`
+	Schedule       []LinkScheduleEntry `json:"schedule,omitempty" binding:"omitempty,max=20,dive"`
+}
+
+// Destination served between starts_at and ends_at over every other rule, either bound can be left open
+type LinkScheduleEntry struct {
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+	Url      string     `json:"url" binding:"required,url"`
+}
+
+// Destination served to a share of visitors in proportion to its weight, zero weight pauses it
+type LinkVariant struct {
+	Name   string `json:"name" binding:"required,max=32"`
+	Url    string `json:"url" binding:"required,url"`
+	Weight int    `json:"weight" binding:"min=0,max=1000"`
+}
+
+// Destinations by visitor device, user agent rules are checked first in order
+type LinkTargeting struct {
+	UserAgents []LinkUserAgentRule `json:"user_agents,omitempty" binding:"omitempty,max=20,dive"`
+	Ios        string              `json:"ios,omitempty" binding:"omitempty,url"`
+	Android    string              `json:"android,omitempty" binding:"omitempty,url"`
+	Desktop    string              `json:"desktop,omitempty" binding:"omitempty,url"`
+	// Keyed by ISO 3166-1 alpha-2 country code
+	Countries map[string]string `json:"countries,omitempty" binding:"omitempty,max=250,dive,keys,iso3166_1_alpha2,endkeys,url"`
+}
+
+type LinkUserAgentRule struct {
+	Pattern string `json:"pattern" binding:"required,max=255"`
+	Url     string `json:"url" binding:"required,url"`
+}
+
+// Utm parameters merged into the original url on redirect
+type LinkUtm struct {
+	Source   string `json:"source,omitempty" binding:"max=255"`
+	Medium   string `json:"medium,omitempty" binding:"max=255"`
+	Campaign string `json:"campaign,omitempty" binding:"max=255"`
+	Term     string `json:"term,omitempty" binding:"max=255"`
+	Content  string `json:"content,omitempty" binding:"max=255"`
 }
 
 type Error struct {
@@ -20,11 +87,75 @@ type Error struct {
 }
 
 type Visit struct {
-	Id        uint64    `json:"id"`
-	LinkId    uint64    `json:"link_id"`
-	Ip        string    `json:"ip"`
-	UserAgent string    `json:"user_agent"`
-	Referer   string    `json:"referer"`
-	Status    int       `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
+	Id             uint64    `json:"id"`
+	LinkId         uint64    `json:"link_id"`
+	Ip             string    `json:"ip"`
+	UserAgent      string    `json:"user_agent"`
+	Referer        string    `json:"referer"`
+	Status         int       `json:"status"`
+	ClientType     string    `json:"client_type"`
+	Browser        string    `json:"browser"`
+	BrowserVersion string    `json:"browser_version"`
+	Os             string    `json:"os"`
+	OsVersion      string    `json:"os_version"`
+	Device         string    `json:"device"`
+	Country        string    `json:"country"`
+	Region         string    `json:"region"`
+	City           string    `json:"city"`
+	Target         string    `json:"target"`
+	Variant        string    `json:"variant"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type ApiKey struct {
+	Id        uint64     `json:"id"`
+	Name      string     `json:"name"`
+	UserId    uint64     `json:"user_id"`
+	Prefix    string     `json:"prefix"`
+	Key       string     `json:"key,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type ApiKeyParams struct {
+	Name   string `json:"name" binding:"required,max=255"`
+	UserId uint64 `json:"user_id" binding:"required"`
+}
+
+type LinkStats struct {
+	LinkId         uint64            `json:"link_id"`
+	From           time.Time         `json:"from"`
+	To             time.Time         `json:"to"`
+	Interval       string            `json:"interval"`
+	TotalClicks    int64             `json:"total_clicks"`
+	UniqueVisitors int64             `json:"unique_visitors"`
+	Clicks         []StatsPoint      `json:"clicks"`
+	TopReferers    []StatsValue      `json:"top_referers"`
+	TopUserAgents  []StatsValue      `json:"top_user_agents"`
+	Statuses       []StatsStatusItem `json:"statuses"`
+	ClientTypes    []StatsValue      `json:"client_types"`
+	TopCountries   []StatsValue      `json:"top_countries"`
+	TopCities      []StatsCity       `json:"top_cities"`
+	Variants       []StatsValue      `json:"variants"`
+}
+
+type StatsCity struct {
+	Country string `json:"country"`
+	City    string `json:"city"`
+	Clicks  int64  `json:"clicks"`
+}
+
+type StatsPoint struct {
+	Time   time.Time `json:"time"`
+	Clicks int64     `json:"clicks"`
+}
+
+type StatsValue struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+}
+
+type StatsStatusItem struct {
+	Status int   `json:"status"`
+	Clicks int64 `json:"clicks"`
 }
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
 )
 
 var (
@@ -13,6 +14,22 @@ var (
 	ErrorShortNameAlreadyUsed = errors.New("short name already in use")
 	ErrorInvalidRange         = errors.New("invalid range param")
 	ErrorInvalidRequest       = errors.New("invalid request")
+	ErrorUnauthorized         = errors.New("unauthorized")
+	ErrorForbidden            = errors.New("forbidden")
+	ErrorLinkQuotaExceeded    = errors.New("workspace link quota exceeded")
+	ErrorLinkExpired          = errors.New("link expired")
+	ErrorLinkDeleted          = errors.New("link deleted")
+	ErrorLinkVisitsExceeded   = errors.New("link visits limit reached")
+	ErrorPasswordRequired     = errors.New("password required")
+	ErrorInvalidPassword      = errors.New("invalid password")
+	ErrorTooManyAttempts      = errors.New("too many password attempts, try again later")
+	ErrorInvalidNumber        = errors.New("invalid number")
+	ErrorInvalidDate          = errors.New("invalid date, expected RFC 3339 or YYYY-MM-DD")
+	ErrorInvalidInterval      = errors.New("invalid interval, expected day or hour")
+	ErrorInvalidTimeWindow    = errors.New("invalid time window")
+	ErrorInvalidBool          = errors.New("invalid boolean")
+	ErrorInvalidClientType    = errors.New("invalid client type, expected human, bot or suspicious")
+	ErrorInvalidDevice        = errors.New("invalid device, expected desktop, mobile, tablet or bot")
 )
 
 type ErrorFieldErrors struct {
@@ -72,3 +89,39 @@ func sendServerError(c *gin.Context) {
 		Error: "Something went wrong",
 	})
 }
+
+// Browsers get a small HTML page, everything else gets the usual JSON error
+func sendGone(err error, c *gin.Context) {
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+		c.Render(http.StatusGone, render.HTML{
+			Template: pageTemplate,
+			Data:     page{Title: "Link is no longer available", Message: err.Error()},
+		})
+		return
+	}
+
+	sendError(http.StatusGone, err, c)
+}
+
+func sendPasswordForm(code int, err error, c *gin.Context) {
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+		data := page{Title: "This link is password protected", PasswordForm: true}
+		if err != nil {
+			data.Error = err.Error()
+		}
+
+		c.Render(code, render.HTML{Template: pageTemplate, Data: data})
+		return
+	}
+
+	if err == nil {
+		err = ErrorPasswordRequired
+	}
+
+	// The form itself is a success for browsers only
+	if code == http.StatusOK {
+		code = http.StatusUnauthorized
+	}
+
+	sendError(code, err, c)
+}
@@ -1,12 +1,20 @@
 package handlers
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/darkartx/go-project-278/internal"
+	"github.com/darkartx/go-project-278/internal/jsoncolumn"
+	"github.com/darkartx/go-project-278/internal/schedule"
+	"github.com/darkartx/go-project-278/internal/targeting"
+	"github.com/darkartx/go-project-278/internal/variant"
 	"github.com/go-playground/validator/v10"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgerrcode"
@@ -18,22 +26,27 @@ import (
 const (
 	shortNameMin = 6
 	shortNameMax = 10
+
+	// Also limited by the binding of LinkParams.Variants
+	maxLinkVariants = 10
 )
 
 type LinkHandler struct {
 	queries *db.Queries
+	cache   *LinkCache
 }
 
-func NewLinkHandler(queries *db.Queries) *LinkHandler {
-	return &LinkHandler{queries: queries}
+func NewLinkHandler(queries *db.Queries, cache *LinkCache) *LinkHandler {
+	return &LinkHandler{queries: queries, cache: cache}
 }
 
 func (h *LinkHandler) Register(rg *gin.RouterGroup) {
-	rg.POST("", h.Create)
-	rg.GET("/:id", h.Get)
-	rg.GET("", Range(RangeParam{0, 9}), h.List)
-	rg.PUT("/:id", h.Update)
-	rg.DELETE("/:id", h.Delete)
+	rg.POST("", RequireRole(RoleEditor), h.Create)
+	rg.GET("/:id", RequireRole(RoleViewer), h.Get)
+	rg.GET("", RequireRole(RoleViewer), Range(RangeParam{0, 9}), h.List)
+	rg.PUT("/:id", RequireRole(RoleEditor), h.Update)
+	rg.DELETE("/:id", RequireRole(RoleAdmin), h.Delete)
+	rg.POST("/:id/restore", RequireRole(RoleAdmin), h.Restore)
 }
 
 func (h *LinkHandler) List(c *gin.Context) {
@@ -43,12 +56,20 @@ func (h *LinkHandler) List(c *gin.Context) {
 	}
 
 	rangeParam := param.(RangeParam)
+	workspace := currentWorkspace(c)
+
+	trashed, err := parseBoolQuery(c, "trashed")
+	if err != nil {
+		fieldErrors := NewErrorFieldErrors()
+		fieldErrors.Add("trashed", err)
+		sendError(http.StatusUnprocessableEntity, fieldErrors, c)
+		return
+	}
 
 	var linksCount int64
 	var links []db.Link
-	var err error
 
-	linksCount, err = h.queries.GetLinkCount(c)
+	linksCount, err = h.queries.GetLinkCount(c, db.GetLinkCountParams{WorkspaceID: workspace.ID, Trashed: trashed})
 	if err != nil {
 		handleDbError(err, c)
 		return
@@ -57,8 +78,10 @@ func (h *LinkHandler) List(c *gin.Context) {
 	limit := rangeParam.End - rangeParam.Start + 1
 
 	links, err = h.queries.ListLinks(c, db.ListLinksParams{
-		Limit:  int32(limit),
-		Offset: int32(rangeParam.Start),
+		WorkspaceID: workspace.ID,
+		Trashed:     trashed,
+		Limit:       int32(limit),
+		Offset:      int32(rangeParam.Start),
 	})
 	if err != nil {
 		handleDbError(err, c)
@@ -68,15 +91,7 @@ func (h *LinkHandler) List(c *gin.Context) {
 	result := make([]Link, 0, len(links))
 
 	for _, item := range links {
-		result = append(
-			result,
-			Link{
-				Id:          uint64(item.ID),
-				OriginalUrl: item.OriginalUrl,
-				ShortName:   item.ShortName,
-				ShortUrl:    makeShortUrl(item.ShortName, c),
-			},
-		)
+		result = append(result, makeLink(item, c))
 	}
 
 	c.Header("Content-Range", fmt.Sprintf("links %d-%d/%d", rangeParam.Start, rangeParam.End, linksCount))
@@ -84,7 +99,7 @@ func (h *LinkHandler) List(c *gin.Context) {
 }
 
 func (h *LinkHandler) Create(c *gin.Context) {
-	input, err := parseAndValidateParams(c)
+	input, err := parseAndValidateParams[LinkParams](c)
 
 	if err != nil {
 		handleParseAndValidationError(err, c)
@@ -98,9 +113,55 @@ func (h *LinkHandler) Create(c *gin.Context) {
 		shortName = internal.GenerateShortName(shortNameMin, shortNameMax)
 	}
 
+	passwordHash, err := hashPassword(input.Password, sql.NullString{})
+	if err != nil {
+		sendServerError(c)
+		return
+	}
+
+	var utm LinkUtm
+	if input.Utm != nil {
+		utm = *input.Utm
+	}
+
+	rules, err := encodeTargeting(input.Targeting)
+	if err != nil {
+		handleParseAndValidationError(err, c)
+		return
+	}
+
+	variants, err := encodeVariants(input.Variants)
+	if err != nil {
+		handleParseAndValidationError(err, c)
+		return
+	}
+
+	entries, err := encodeSchedule(input.Schedule)
+	if err != nil {
+		handleParseAndValidationError(err, c)
+		return
+	}
+
 	link, err := h.queries.CreateLink(c, db.CreateLinkParams{
-		OriginalUrl: input.OriginalUrl,
-		ShortName:   shortName,
+		OriginalUrl:    input.OriginalUrl,
+		ShortName:      shortName,
+		ExpiresAt:      nullTime(input.ExpiresAt),
+		ExpiredUrl:     nullString(input.ExpiredUrl),
+		MaxVisits:      nullInt32(input.MaxVisits),
+		PasswordHash:   passwordHash,
+		RedirectType:   nullInt16(input.RedirectType),
+		ForwardQuery:   input.ForwardQuery,
+		ForwardPath:    input.ForwardPath,
+		UtmSource:      nullString(utm.Source),
+		UtmMedium:      nullString(utm.Medium),
+		UtmCampaign:    nullString(utm.Campaign),
+		UtmTerm:        nullString(utm.Term),
+		UtmContent:     nullString(utm.Content),
+		Targeting:      rules,
+		Variants:       variants,
+		StickyVariants: input.StickyVariants,
+		Schedule:       entries,
+		OwnerID:        currentUser(c).ID,
 	})
 
 	if err != nil {
@@ -108,12 +169,7 @@ func (h *LinkHandler) Create(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, Link{
-		Id:          uint64(link.ID),
-		OriginalUrl: link.OriginalUrl,
-		ShortName:   link.ShortName,
-		ShortUrl:    makeShortUrl(link.ShortName, c),
-	})
+	c.JSON(http.StatusCreated, makeLink(link, c))
 }
 
 func (h *LinkHandler) Get(c *gin.Context) {
@@ -125,12 +181,13 @@ func (h *LinkHandler) Get(c *gin.Context) {
 	}
 
 	var link db.Link
-	if link, err = h.queries.GetLink(c, int64(id)); err != nil {
+	link, err = h.queries.GetWorkspaceLink(c, db.GetWorkspaceLinkParams{ID: int64(id), WorkspaceID: currentWorkspace(c).ID})
+	if err != nil {
 		handleDbError(err, c)
 		return
 	}
 
-	c.JSON(http.StatusOK, Link{uint64(link.ID), link.OriginalUrl, link.ShortName, makeShortUrl(link.ShortName, c)})
+	c.JSON(http.StatusOK, makeLink(link, c))
 }
 
 func (h *LinkHandler) Update(c *gin.Context) {
@@ -142,7 +199,7 @@ func (h *LinkHandler) Update(c *gin.Context) {
 	}
 
 	var input LinkParams
-	input, err = parseAndValidateParams(c)
+	input, err = parseAndValidateParams[LinkParams](c)
 
 	if err != nil {
 		handleParseAndValidationError(err, c)
@@ -156,14 +213,75 @@ func (h *LinkHandler) Update(c *gin.Context) {
 		shortName = internal.GenerateShortName(shortNameMin, shortNameMax)
 	}
 
+	user := currentUser(c)
+
+	// Links of other members are read only, admins delete them
 	var link db.Link
-	link, err = h.queries.UpdateLink(c, db.UpdateLinkParams{ID: int64(id), OriginalUrl: input.OriginalUrl, ShortName: shortName})
+	link, err = h.queries.GetOwnedLink(c, db.GetOwnedLinkParams{ID: int64(id), OwnerID: user.ID})
+	if err != nil {
+		handleDbError(err, c)
+		return
+	}
+
+	var passwordHash sql.NullString
+	if passwordHash, err = hashPassword(input.Password, link.PasswordHash); err != nil {
+		sendServerError(c)
+		return
+	}
+
+	var utm LinkUtm
+	if input.Utm != nil {
+		utm = *input.Utm
+	}
+
+	var rules json.RawMessage
+	if rules, err = encodeTargeting(input.Targeting); err != nil {
+		handleParseAndValidationError(err, c)
+		return
+	}
+
+	var variants json.RawMessage
+	if variants, err = encodeVariants(input.Variants); err != nil {
+		handleParseAndValidationError(err, c)
+		return
+	}
+
+	var entries json.RawMessage
+	if entries, err = encodeSchedule(input.Schedule); err != nil {
+		handleParseAndValidationError(err, c)
+		return
+	}
+
+	link, err = h.queries.UpdateLink(c, db.UpdateLinkParams{
+		ID:             int64(id),
+		OriginalUrl:    input.OriginalUrl,
+		ShortName:      shortName,
+		ExpiresAt:      nullTime(input.ExpiresAt),
+		ExpiredUrl:     nullString(input.ExpiredUrl),
+		MaxVisits:      nullInt32(input.MaxVisits),
+		PasswordHash:   passwordHash,
+		RedirectType:   nullInt16(input.RedirectType),
+		ForwardQuery:   input.ForwardQuery,
+		ForwardPath:    input.ForwardPath,
+		UtmSource:      nullString(utm.Source),
+		UtmMedium:      nullString(utm.Medium),
+		UtmCampaign:    nullString(utm.Campaign),
+		UtmTerm:        nullString(utm.Term),
+		UtmContent:     nullString(utm.Content),
+		Targeting:      rules,
+		Variants:       variants,
+		StickyVariants: input.StickyVariants,
+		Schedule:       entries,
+		OwnerID:        user.ID,
+	})
 	if err != nil {
 		handleLinkCreateUpdateError(err, c)
 		return
 	}
 
-	c.JSON(http.StatusOK, Link{id, link.OriginalUrl, link.ShortName, makeShortUrl(link.ShortName, c)})
+	h.invalidate(link.ID, c)
+
+	c.JSON(http.StatusOK, makeLink(link, c))
 }
 
 func (h *LinkHandler) Delete(c *gin.Context) {
@@ -174,24 +292,215 @@ func (h *LinkHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if _, err = h.queries.GetLink(c, int64(id)); err != nil {
+	workspace := currentWorkspace(c)
+
+	_, err = h.queries.GetWorkspaceLink(c, db.GetWorkspaceLinkParams{ID: int64(id), WorkspaceID: workspace.ID})
+	if err != nil {
 		handleDbError(err, c)
 		return
 	}
 
-	if err = h.queries.DeleteLink(c, int64(id)); err != nil {
+	// Moved to the trash, the link and its visits are deleted when the trash is purged
+	if err = h.queries.TrashLink(c, db.TrashLinkParams{ID: int64(id), WorkspaceID: workspace.ID}); err != nil {
 		handleDbError(err, c)
 		return
 	}
 
+	h.invalidate(int64(id), c)
+
 	c.Status(http.StatusNoContent)
 }
 
-func parseAndValidateParams(c *gin.Context) (LinkParams, error) {
-	var params LinkParams
+func (h *LinkHandler) Restore(c *gin.Context) {
+	id, err := parseId(c)
+
+	if err != nil {
+		sendError(http.StatusBadRequest, err, c)
+		return
+	}
+
+	link, err := h.queries.RestoreLink(c, db.RestoreLinkParams{ID: int64(id), WorkspaceID: currentWorkspace(c).ID})
+	if err != nil {
+		if isQuotaExceeded(err) {
+			sendError(http.StatusForbidden, ErrorLinkQuotaExceeded, c)
+			return
+		}
+
+		handleDbError(err, c)
+		return
+	}
+
+	h.invalidate(link.ID, c)
+
+	c.JSON(http.StatusOK, makeLink(link, c))
+}
+
+// The change is already saved, a failed notification only leaves other instances stale until the ttl
+func (h *LinkHandler) invalidate(id int64, c *gin.Context) {
+	if err := h.cache.Invalidate(c, id); err != nil {
+		log.Printf("invalidate link %d: %v", id, err)
+	}
+}
+
+func makeLink(link db.Link, c *gin.Context) Link {
+	result := Link{
+		Id:           uint64(link.ID),
+		OriginalUrl:  link.OriginalUrl,
+		ShortName:    link.ShortName,
+		ShortUrl:     makeShortUrl(link.ShortName, c),
+		OwnerId:      uint64(link.OwnerID),
+		ExpiredUrl:   link.ExpiredUrl.String,
+		HasPassword:  link.PasswordHash.Valid,
+		ForwardQuery: link.ForwardQuery,
+		ForwardPath:  link.ForwardPath,
+	}
+
+	if link.ExpiresAt.Valid {
+		result.ExpiresAt = &link.ExpiresAt.Time
+	}
+
+	if link.DeletedAt.Valid {
+		result.DeletedAt = &link.DeletedAt.Time
+	}
+
+	if link.RedirectType.Valid {
+		result.RedirectType = &link.RedirectType.Int16
+	}
+
+	utm := LinkUtm{
+		Source:   link.UtmSource.String,
+		Medium:   link.UtmMedium.String,
+		Campaign: link.UtmCampaign.String,
+		Term:     link.UtmTerm.String,
+		Content:  link.UtmContent.String,
+	}
+	if utm != (LinkUtm{}) {
+		result.Utm = &utm
+	}
+
+	result.Targeting = makeLinkTargeting(link.Targeting)
+	result.Variants = makeLinkVariants(link.Variants)
+	result.StickyVariants = link.StickyVariants
+	result.Schedule = makeLinkSchedule(link.Schedule)
+
+	if link.MaxVisits.Valid {
+		remaining := max(link.MaxVisits.Int32-link.VisitsCount, 0)
+		result.MaxVisits = &link.MaxVisits.Int32
+		result.RemainingVisits = &remaining
+	}
+
+	return result
+}
+
+// Unreadable rules are left out, redirects ignore them too
+func makeLinkTargeting(data json.RawMessage) *LinkTargeting {
+	rules, err := jsoncolumn.Decode[targeting.Rules](data)
+	if err != nil || rules.IsEmpty() {
+		return nil
+	}
+
+	result := LinkTargeting{Ios: rules.Ios, Android: rules.Android, Desktop: rules.Desktop, Countries: rules.Countries}
+	for _, rule := range rules.UserAgents {
+		result.UserAgents = append(result.UserAgents, LinkUserAgentRule{Pattern: rule.Pattern, Url: rule.Url})
+	}
+
+	return &result
+}
+
+func encodeTargeting(input *LinkTargeting) (json.RawMessage, error) {
+	var rules targeting.Rules
+
+	if input != nil {
+		rules = targeting.Rules{Ios: input.Ios, Android: input.Android, Desktop: input.Desktop, Countries: input.Countries}
+		for _, rule := range input.UserAgents {
+			rules.UserAgents = append(rules.UserAgents, targeting.UserAgentRule{Pattern: rule.Pattern, Url: rule.Url})
+		}
+	}
+
+	return encodeColumn("targeting", rules, targeting.Rules.Validate)
+}
+
+func makeLinkVariants(data json.RawMessage) []LinkVariant {
+	variants, err := jsoncolumn.Decode[[]variant.Variant](data)
+	if err != nil {
+		return nil
+	}
+
+	var result []LinkVariant
+	for _, item := range variants {
+		result = append(result, LinkVariant{Name: item.Name, Url: item.Url, Weight: item.Weight})
+	}
+
+	return result
+}
+
+func encodeVariants(input []LinkVariant) (json.RawMessage, error) {
+	variants := make([]variant.Variant, 0, len(input))
+	for _, item := range input {
+		variants = append(variants, variant.Variant{Name: item.Name, Url: item.Url, Weight: item.Weight})
+	}
+
+	return encodeColumn("variants", variants, variant.Validate)
+}
+
+func makeLinkSchedule(data json.RawMessage) []LinkScheduleEntry {
+	entries, err := jsoncolumn.Decode[[]schedule.Entry](data)
+	if err != nil {
+		return nil
+	}
+
+	var result []LinkScheduleEntry
+	for _, entry := range entries {
+		result = append(result, LinkScheduleEntry{StartsAt: entry.StartsAt, EndsAt: entry.EndsAt, Url: entry.Url})
+	}
+
+	return result
+}
+
+func encodeSchedule(input []LinkScheduleEntry) (json.RawMessage, error) {
+	entries := make([]schedule.Entry, 0, len(input))
+	for _, item := range input {
+		entries = append(entries, schedule.Entry{StartsAt: item.StartsAt, EndsAt: item.EndsAt, Url: item.Url})
+	}
+
+	return encodeColumn("schedule", entries, schedule.Validate)
+}
+
+// encodeColumn validates a value kept in a json column of the link, the validation error is reported on the field
+func encodeColumn[T any](field string, value T, validate func(T) error) (json.RawMessage, error) {
+	if err := validate(value); err != nil {
+		fieldErrors := NewErrorFieldErrors()
+		fieldErrors.Add(field, err)
+		return nil, fieldErrors
+	}
+
+	return json.Marshal(value)
+}
+
+// Password is optional: nil keeps the current hash, an empty string removes it
+func hashPassword(password *string, current sql.NullString) (sql.NullString, error) {
+	if password == nil {
+		return current, nil
+	}
+
+	if *password == "" {
+		return sql.NullString{}, nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+
+	return sql.NullString{String: string(hash), Valid: true}, nil
+}
+
+func parseAndValidateParams[T any](c *gin.Context) (T, error) {
+	var params T
 
 	if err := c.ShouldBindJSON(&params); err != nil {
 		var ve validator.ValidationErrors
+		var empty T
 
 		if errors.As(err, &ve) {
 			newErr := NewErrorFieldErrors()
@@ -200,10 +509,10 @@ func parseAndValidateParams(c *gin.Context) (LinkParams, error) {
 				newErr.Add(ei.Field(), ei)
 			}
 
-			return LinkParams{}, newErr
+			return empty, newErr
 		}
 
-		return LinkParams{}, ErrorInvalidRequest
+		return empty, ErrorInvalidRequest
 	}
 
 	return params, nil
@@ -233,5 +542,17 @@ func handleLinkCreateUpdateError(err error, c *gin.Context) {
 		}
 	}
 
+	if isQuotaExceeded(err) {
+		sendError(http.StatusForbidden, ErrorLinkQuotaExceeded, c)
+		return
+	}
+
 	handleDbError(err, c)
 }
+
+// The quota is checked by a trigger with the workspace locked, see the add_workspace_link_quota migration
+func isQuotaExceeded(err error) bool {
+	var pgErr *pgconn.PgError
+
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.CheckViolation && pgErr.ConstraintName == "workspace_link_quota"
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	db "github.com/darkartx/go-project-278/db/generated"
+	"github.com/darkartx/go-project-278/internal/cache"
+)
+
+const LinkInvalidationChannel = "links_changed"
+
+type linkCacheKey struct {
+	Domain    string
+	ShortName string
+}
+
+// LinkCache keeps links resolved by redirects. Changes of a link are announced with NOTIFY
+// so every instance listening to LinkInvalidationChannel evicts it.
+// A cache with zero size only passes lookups through.
+type LinkCache struct {
+	queries *db.Queries
+	load    func(ctx context.Context, arg db.GetLinkByShortNameParams) (db.Link, error)
+	links   *cache.LRU[linkCacheKey, RoutedLink]
+
+	// generation changes on every eviction, a link loaded during one may be stale and isn't cached
+	mu         sync.Mutex
+	generation uint64
+}
+
+func NewLinkCache(queries *db.Queries, size int, ttl time.Duration) *LinkCache {
+	return &LinkCache{
+		queries: queries,
+		load:    queries.GetLinkByShortName,
+		links:   cache.New[linkCacheKey, RoutedLink](size, ttl),
+	}
+}
+
+func (lc *LinkCache) GetLinkByShortName(ctx context.Context, arg db.GetLinkByShortNameParams) (RoutedLink, error) {
+	key := linkCacheKey{Domain: arg.Domain.String, ShortName: arg.ShortName}
+
+	if link, ok := lc.links.Get(key); ok {
+		return link, nil
+	}
+
+	generation := lc.currentGeneration()
+
+	row, err := lc.load(ctx, arg)
+	if err != nil {
+		return RoutedLink{}, err
+	}
+
+	link := newRoutedLink(row)
+
+	lc.mu.Lock()
+	if lc.generation == generation {
+		lc.links.Set(key, link)
+	}
+	lc.mu.Unlock()
+
+	return link, nil
+}
+
+// Evicts the link here and notifies the other instances
+func (lc *LinkCache) Invalidate(ctx context.Context, id int64) error {
+	lc.Evict(id)
+
+	return lc.queries.Notify(ctx, db.NotifyParams{
+		Channel: LinkInvalidationChannel,
+		Payload: strconv.FormatInt(id, 10),
+	})
+}
+
+func (lc *LinkCache) Evict(id int64) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	lc.generation++
+	lc.links.RemoveFunc(func(key linkCacheKey, link RoutedLink) bool {
+		return link.ID == id
+	})
+}
+
+func (lc *LinkCache) Purge() {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	lc.generation++
+	lc.links.Purge()
+}
+
+func (lc *LinkCache) currentGeneration() uint64 {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	return lc.generation
+}
+
+// Evicts links changed by any instance until ctx is done
+func (lc *LinkCache) Listen(ctx context.Context, databaseUrl string) {
+	cache.Listen(ctx, databaseUrl, LinkInvalidationChannel, lc.Purge, func(payload string) {
+		id, err := strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			log.Printf("invalid link invalidation payload: %q", payload)
+			return
+		}
+
+		lc.Evict(id)
+	})
+}
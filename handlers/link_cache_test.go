@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	db "github.com/darkartx/go-project-278/db/generated"
+)
+
+func TestLinkCacheSkipsLinksEvictedWhileLoading(t *testing.T) {
+	lc := NewLinkCache(nil, 10, time.Minute)
+	arg := db.GetLinkByShortNameParams{ShortName: "abc"}
+
+	for name, evict := range map[string]func(){
+		"evict": func() { lc.Evict(1) },
+		"purge": lc.Purge,
+	} {
+		lc.load = func(ctx context.Context, arg db.GetLinkByShortNameParams) (db.Link, error) {
+			evict()
+			return db.Link{ID: 1, ShortName: arg.ShortName}, nil
+		}
+
+		link, err := lc.GetLinkByShortName(context.Background(), arg)
+		if err != nil || link.ID != 1 {
+			t.Fatalf("%s: GetLinkByShortName() = %v, %v; want link 1", name, link.ID, err)
+		}
+
+		if n := lc.links.Len(); n != 0 {
+			t.Errorf("%s: cached %d links; want the stale link left out", name, n)
+		}
+	}
+
+	lc.load = func(ctx context.Context, arg db.GetLinkByShortNameParams) (db.Link, error) {
+		return db.Link{ID: 1, ShortName: arg.ShortName}, nil
+	}
+
+	if _, err := lc.GetLinkByShortName(context.Background(), arg); err != nil {
+		t.Fatalf("GetLinkByShortName() error = %v", err)
+	}
+
+	if n := lc.links.Len(); n != 1 {
+		t.Errorf("cached %d links; want 1", n)
+	}
+}
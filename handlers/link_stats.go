@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	db "github.com/darkartx/go-project-278/db/generated"
+)
+
+const (
+	IntervalDay  = "day"
+	IntervalHour = "hour"
+
+	// Dimensions of visit_daily_stats
+	dimensionTotal     = "total"
+	dimensionHour      = "hour"
+	dimensionCountry   = "country"
+	dimensionCity      = "city"
+	dimensionReferer   = "referer"
+	dimensionUserAgent = "user_agent"
+	dimensionVariant   = "variant"
+
+	defaultStatsWindow = 30 * 24 * time.Hour
+	defaultStatsLimit  = 10
+	maxStatsLimit      = 100
+	maxStatsPoints     = 2000
+)
+
+type LinkStatsHandler struct {
+	queries *db.Queries
+}
+
+type statsParams struct {
+	From        time.Time
+	To          time.Time
+	Interval    string
+	Limit       int32
+	IncludeBots bool
+}
+
+func NewLinkStatsHandler(queries *db.Queries) *LinkStatsHandler {
+	return &LinkStatsHandler{queries: queries}
+}
+
+func (h *LinkStatsHandler) Register(rg *gin.RouterGroup) {
+	rg.GET("/:id/stats", RequireRole(RoleViewer), h.Get)
+}
+
+func (h *LinkStatsHandler) Get(c *gin.Context) {
+	id, err := parseId(c)
+
+	if err != nil {
+		sendError(http.StatusBadRequest, err, c)
+		return
+	}
+
+	params, err := parseStatsParams(c, time.Now())
+	if err != nil {
+		handleParseAndValidationError(err, c)
+		return
+	}
+
+	link, err := h.queries.GetWorkspaceLink(c, db.GetWorkspaceLinkParams{ID: int64(id), WorkspaceID: currentWorkspace(c).ID})
+	if err != nil {
+		handleDbError(err, c)
+		return
+	}
+
+	totals, err := h.queries.GetLinkVisitTotals(c, db.GetLinkVisitTotalsParams{
+		LinkID:      link.ID,
+		DayFrom:     params.From,
+		DayTo:       params.To,
+		IncludeBots: params.IncludeBots,
+	})
+	if err != nil {
+		handleDbError(err, c)
+		return
+	}
+
+	seriesDimension := dimensionTotal
+	if params.Interval == IntervalHour {
+		seriesDimension = dimensionHour
+	}
+
+	series, err := h.queries.ListLinkVisitSeries(c, db.ListLinkVisitSeriesParams{
+		LinkID:      link.ID,
+		Dimension:   seriesDimension,
+		DayFrom:     params.From,
+		DayTo:       params.To,
+		IncludeBots: params.IncludeBots,
+	})
+	if err != nil {
+		handleDbError(err, c)
+		return
+	}
+
+	top := make(map[string][]StatsValue)
+	for _, dimension := range []string{dimensionReferer, dimensionUserAgent, dimensionCountry, dimensionCity, dimensionVariant} {
+		limit := params.Limit
+		// Variants are compared with each other, all of them are listed
+		if dimension == dimensionVariant {
+			limit = maxLinkVariants
+		}
+
+		rows, err := h.queries.ListLinkTopValues(c, db.ListLinkTopValuesParams{
+			LinkID:      link.ID,
+			Dimension:   dimension,
+			DayFrom:     params.From,
+			DayTo:       params.To,
+			IncludeBots: params.IncludeBots,
+			Limit:       limit,
+		})
+		if err != nil {
+			handleDbError(err, c)
+			return
+		}
+
+		values := make([]StatsValue, 0, len(rows))
+		for _, row := range rows {
+			values = append(values, StatsValue{Value: row.Value, Clicks: row.Clicks})
+		}
+
+		top[dimension] = values
+	}
+
+	statuses, err := h.queries.ListLinkVisitStatuses(c, db.ListLinkVisitStatusesParams{
+		LinkID:      link.ID,
+		DayFrom:     params.From,
+		DayTo:       params.To,
+		IncludeBots: params.IncludeBots,
+	})
+	if err != nil {
+		handleDbError(err, c)
+		return
+	}
+
+	clientTypes, err := h.queries.ListLinkVisitClientTypes(c, db.ListLinkVisitClientTypesParams{
+		LinkID:  link.ID,
+		DayFrom: params.From,
+		DayTo:   params.To,
+	})
+	if err != nil {
+		handleDbError(err, c)
+		return
+	}
+
+	result := LinkStats{
+		LinkId:         uint64(link.ID),
+		From:           params.From,
+		To:             params.To,
+		Interval:       params.Interval,
+		TotalClicks:    totals.TotalClicks,
+		UniqueVisitors: totals.UniqueVisitors,
+		Clicks:         makeStatsSeries(params, series),
+		TopReferers:    top[dimensionReferer],
+		TopUserAgents:  top[dimensionUserAgent],
+		Statuses:       make([]StatsStatusItem, 0, len(statuses)),
+		ClientTypes:    make([]StatsValue, 0, len(clientTypes)),
+		TopCountries:   top[dimensionCountry],
+		TopCities:      make([]StatsCity, 0, len(top[dimensionCity])),
+		Variants:       top[dimensionVariant],
+	}
+
+	for _, item := range statuses {
+		result.Statuses = append(result.Statuses, StatsStatusItem{Status: int(item.Status), Clicks: item.Clicks})
+	}
+
+	for _, item := range clientTypes {
+		result.ClientTypes = append(result.ClientTypes, StatsValue{Value: item.ClientType, Clicks: item.Clicks})
+	}
+
+	// Cities are rolled up as country/city
+	for _, item := range top[dimensionCity] {
+		country, city, _ := strings.Cut(item.Value, "/")
+		result.TopCities = append(result.TopCities, StatsCity{Country: country, City: city, Clicks: item.Clicks})
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func parseStatsParams(c *gin.Context, now time.Time) (statsParams, error) {
+	params := statsParams{
+		To:       now.UTC(),
+		Interval: IntervalDay,
+		Limit:    defaultStatsLimit,
+	}
+	fieldErrors := NewErrorFieldErrors()
+
+	if value := c.Query("to"); value != "" {
+		to, dateOnly, err := parseFilterTime(value)
+		if err != nil {
+			fieldErrors.Add("to", err)
+		}
+
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+
+		params.To = to.UTC()
+	}
+
+	params.From = params.To.Add(-defaultStatsWindow)
+
+	if value := c.Query("from"); value != "" {
+		from, _, err := parseFilterTime(value)
+		if err != nil {
+			fieldErrors.Add("from", err)
+		}
+
+		params.From = from.UTC()
+	}
+
+	if value := c.Query("interval"); value != "" {
+		if value != IntervalDay && value != IntervalHour {
+			fieldErrors.Add("interval", ErrorInvalidInterval)
+		}
+
+		params.Interval = value
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxStatsLimit {
+			fieldErrors.Add("limit", ErrorInvalidNumber)
+		}
+
+		params.Limit = int32(limit)
+	}
+
+	includeBots, err := parseBoolQuery(c, "include_bots")
+	if err != nil {
+		fieldErrors.Add("include_bots", err)
+	}
+
+	params.IncludeBots = includeBots
+
+	if len(fieldErrors.Errors) > 0 {
+		return statsParams{}, fieldErrors
+	}
+
+	// Stats are rolled up per UTC day, so the window is widened to whole days
+	params.From = truncateToInterval(params.From, IntervalDay)
+	if to := truncateToInterval(params.To, IntervalDay); !to.Equal(params.To) {
+		params.To = to.AddDate(0, 0, 1)
+	}
+
+	if !params.From.Before(params.To) || params.To.Sub(params.From) > intervalDuration(params.Interval)*maxStatsPoints {
+		fieldErrors.Add("from", ErrorInvalidTimeWindow)
+		return statsParams{}, fieldErrors
+	}
+
+	return params, nil
+}
+
+// Fills buckets without visits with zeros so the series has no gaps
+func makeStatsSeries(params statsParams, rows []db.ListLinkVisitSeriesRow) []StatsPoint {
+	clicks := make(map[time.Time]int64, len(rows))
+	for _, row := range rows {
+		clicks[row.Bucket.UTC()] = row.Clicks
+	}
+
+	step := intervalDuration(params.Interval)
+	result := make([]StatsPoint, 0)
+
+	for bucket := truncateToInterval(params.From, params.Interval); bucket.Before(params.To); bucket = bucket.Add(step) {
+		result = append(result, StatsPoint{Time: bucket, Clicks: clicks[bucket]})
+	}
+
+	return result
+}
+
+func intervalDuration(interval string) time.Duration {
+	if interval == IntervalHour {
+		return time.Hour
+	}
+
+	return 24 * time.Hour
+}
+
+func truncateToInterval(t time.Time, interval string) time.Time {
+	t = t.UTC()
+
+	if interval == IntervalHour {
+		return t.Truncate(time.Hour)
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
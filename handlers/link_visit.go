@@ -1,39 +1,119 @@
 package handlers
 
 import (
+	"database/sql"
 	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	db "github.com/darkartx/go-project-278/db/generated"
+	"github.com/darkartx/go-project-278/internal/useragent"
+	"github.com/darkartx/go-project-278/internal/visitor"
 )
 
+const dateLayout = "2006-01-02"
+
+var devices = []string{useragent.DeviceDesktop, useragent.DeviceMobile, useragent.DeviceTablet, useragent.DeviceBot}
+
 type LinkVisitHandler struct {
 	queries *db.Queries
 }
 
+type visitFilter struct {
+	LinkID      sql.NullInt64
+	CreatedFrom sql.NullTime
+	CreatedTo   sql.NullTime
+	Status      sql.NullInt16
+	Referer     sql.NullString
+	Ip          sql.NullString
+	ClientType  sql.NullString
+	IncludeBots bool
+	Browser     sql.NullString
+	Os          sql.NullString
+	Device      sql.NullString
+	Country     sql.NullString
+}
+
 func NewLinkVisitHandler(queries *db.Queries) *LinkVisitHandler {
 	return &LinkVisitHandler{queries: queries}
 }
 
 func (h *LinkVisitHandler) Register(rg *gin.RouterGroup) {
-	rg.GET("", Range(RangeParam{0, 9}), h.List)
+	rg.GET("", RequireRole(RoleViewer), Range(RangeParam{0, 9}), h.List)
+}
+
+// Visits of a single link are served under the links group: /links/:id/visits
+func (h *LinkVisitHandler) RegisterLink(rg *gin.RouterGroup) {
+	rg.GET("/:id/visits", RequireRole(RoleViewer), Range(RangeParam{0, 9}), h.ListForLink)
 }
 
 func (h *LinkVisitHandler) List(c *gin.Context) {
+	filter, err := parseVisitFilter(c)
+	if err != nil {
+		handleParseAndValidationError(err, c)
+		return
+	}
+
+	h.list(filter, c)
+}
+
+func (h *LinkVisitHandler) ListForLink(c *gin.Context) {
+	id, err := parseId(c)
+
+	if err != nil {
+		sendError(http.StatusBadRequest, err, c)
+		return
+	}
+
+	filter, err := parseVisitFilter(c)
+	if err != nil {
+		handleParseAndValidationError(err, c)
+		return
+	}
+
+	link, err := h.queries.GetWorkspaceLink(c, db.GetWorkspaceLinkParams{ID: int64(id), WorkspaceID: currentWorkspace(c).ID})
+	if err != nil {
+		handleDbError(err, c)
+		return
+	}
+
+	filter.LinkID = sql.NullInt64{Int64: link.ID, Valid: true}
+
+	h.list(filter, c)
+}
+
+func (h *LinkVisitHandler) list(filter visitFilter, c *gin.Context) {
 	param, exists := c.Get("range")
 	if !exists {
 		param = RangeParam{0, 9}
 	}
 
 	rangeParam := param.(RangeParam)
+	workspace := currentWorkspace(c)
 
 	var visitsCount int64
 	var visits []db.Visit
 	var err error
 
-	visitsCount, err = h.queries.GetVisitCount(c)
+	visitsCount, err = h.queries.GetWorkspaceVisitCount(c, db.GetWorkspaceVisitCountParams{
+		WorkspaceID: workspace.ID,
+		LinkID:      filter.LinkID,
+		CreatedFrom: filter.CreatedFrom,
+		CreatedTo:   filter.CreatedTo,
+		Status:      filter.Status,
+		Referer:     filter.Referer,
+		Ip:          filter.Ip,
+		ClientType:  filter.ClientType,
+		IncludeBots: filter.IncludeBots,
+		Browser:     filter.Browser,
+		Os:          filter.Os,
+		Device:      filter.Device,
+		Country:     filter.Country,
+	})
 	if err != nil {
 		handleDbError(err, c)
 		return
@@ -41,9 +121,22 @@ func (h *LinkVisitHandler) List(c *gin.Context) {
 
 	limit := rangeParam.End - rangeParam.Start + 1
 
-	visits, err = h.queries.ListVisits(c, db.ListVisitsParams{
-		Limit:  int32(limit),
-		Offset: int32(rangeParam.Start),
+	visits, err = h.queries.ListWorkspaceVisits(c, db.ListWorkspaceVisitsParams{
+		WorkspaceID: workspace.ID,
+		LinkID:      filter.LinkID,
+		CreatedFrom: filter.CreatedFrom,
+		CreatedTo:   filter.CreatedTo,
+		Status:      filter.Status,
+		Referer:     filter.Referer,
+		Ip:          filter.Ip,
+		ClientType:  filter.ClientType,
+		IncludeBots: filter.IncludeBots,
+		Browser:     filter.Browser,
+		Os:          filter.Os,
+		Device:      filter.Device,
+		Country:     filter.Country,
+		Limit:       int32(limit),
+		Offset:      int32(rangeParam.Start),
 	})
 	if err != nil {
 		handleDbError(err, c)
@@ -56,13 +149,24 @@ func (h *LinkVisitHandler) List(c *gin.Context) {
 		result = append(
 			result,
 			Visit{
-				Id:        uint64(item.ID),
-				LinkId:    uint64(item.LinkID),
-				Ip:        item.Ip.String,
-				UserAgent: item.UserAgent.String,
-				Status:    int(item.Status),
-				Referer:   item.Referer.String,
-				CreatedAt: item.CreatedAt,
+				Id:             uint64(item.ID),
+				LinkId:         uint64(item.LinkID),
+				Ip:             item.Ip.String,
+				UserAgent:      item.UserAgent.String,
+				Status:         int(item.Status),
+				Referer:        item.Referer.String,
+				ClientType:     item.ClientType,
+				Browser:        item.Browser.String,
+				BrowserVersion: item.BrowserVersion.String,
+				Os:             item.Os.String,
+				OsVersion:      item.OsVersion.String,
+				Device:         item.Device.String,
+				Country:        item.Country.String,
+				Region:         item.Region.String,
+				City:           item.City.String,
+				Target:         item.Target.String,
+				Variant:        item.Variant.String,
+				CreatedAt:      item.CreatedAt,
 			},
 		)
 	}
@@ -70,3 +174,114 @@ func (h *LinkVisitHandler) List(c *gin.Context) {
 	c.Header("Content-Range", fmt.Sprintf("visits %d-%d/%d", rangeParam.Start, rangeParam.End, visitsCount))
 	c.JSON(http.StatusOK, result)
 }
+
+func parseVisitFilter(c *gin.Context) (visitFilter, error) {
+	var filter visitFilter
+	fieldErrors := NewErrorFieldErrors()
+
+	if value := c.Query("link_id"); value != "" {
+		linkId, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || linkId <= 0 {
+			fieldErrors.Add("link_id", ErrorInvalidNumber)
+		}
+
+		filter.LinkID = sql.NullInt64{Int64: linkId, Valid: true}
+	}
+
+	if value := c.Query("from"); value != "" {
+		from, _, err := parseFilterTime(value)
+		if err != nil {
+			fieldErrors.Add("from", err)
+		}
+
+		filter.CreatedFrom = sql.NullTime{Time: from, Valid: true}
+	}
+
+	if value := c.Query("to"); value != "" {
+		to, dateOnly, err := parseFilterTime(value)
+		if err != nil {
+			fieldErrors.Add("to", err)
+		}
+
+		// A bare date includes the whole day
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+
+		filter.CreatedTo = sql.NullTime{Time: to, Valid: true}
+	}
+
+	if value := c.Query("status"); value != "" {
+		status, err := strconv.ParseInt(value, 10, 16)
+		if err != nil {
+			fieldErrors.Add("status", ErrorInvalidNumber)
+		}
+
+		filter.Status = sql.NullInt16{Int16: int16(status), Valid: true}
+	}
+
+	filter.Referer = nullString(c.Query("referer"))
+	filter.Ip = nullString(c.Query("ip"))
+
+	filter.Browser = nullString(c.Query("browser"))
+	filter.Os = nullString(c.Query("os"))
+	filter.Country = nullString(c.Query("country"))
+
+	if value := c.Query("device"); value != "" {
+		if !slices.Contains(devices, value) {
+			fieldErrors.Add("device", ErrorInvalidDevice)
+		}
+
+		filter.Device = nullString(value)
+	}
+
+	includeBots, err := parseBoolQuery(c, "include_bots")
+	if err != nil {
+		fieldErrors.Add("include_bots", err)
+	}
+
+	filter.IncludeBots = includeBots
+
+	// Asking for a client type explicitly includes bots
+	if value := c.Query("client_type"); value != "" {
+		if value != visitor.Human && value != visitor.Bot && value != visitor.Suspicious {
+			fieldErrors.Add("client_type", ErrorInvalidClientType)
+		}
+
+		filter.ClientType = nullString(value)
+		filter.IncludeBots = true
+	}
+
+	if len(fieldErrors.Errors) > 0 {
+		return visitFilter{}, fieldErrors
+	}
+
+	return filter, nil
+}
+
+// parseBoolQuery reads an optional boolean query param, false when it's missing
+func parseBoolQuery(c *gin.Context, name string) (bool, error) {
+	value := c.Query(name)
+	if value == "" {
+		return false, nil
+	}
+
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, ErrorInvalidBool
+	}
+
+	return result, nil
+}
+
+func parseFilterTime(value string) (time.Time, bool, error) {
+	if result, err := time.Parse(time.RFC3339, value); err == nil {
+		return result, false, nil
+	}
+
+	if result, err := time.Parse(dateLayout, value); err == nil {
+		return result, true, nil
+	}
+
+	return time.Time{}, false, ErrorInvalidDate
+}
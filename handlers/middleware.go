@@ -2,9 +2,19 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darkartx/go-project-278/internal"
+	"github.com/darkartx/go-project-278/internal/geoip"
+	"github.com/darkartx/go-project-278/internal/privacy"
+	"github.com/darkartx/go-project-278/internal/recorder"
+	"github.com/darkartx/go-project-278/internal/useragent"
+	"github.com/darkartx/go-project-278/internal/visitor"
 
 	db "github.com/darkartx/go-project-278/db/generated"
 
@@ -70,7 +80,19 @@ func parseRange(query string) (RangeParam, error) {
 	return result, nil
 }
 
-func RecordVisit(queries *db.Queries) gin.HandlerFunc {
+const (
+	maxUserAgentLength = 1024
+	maxRefererLength   = 2083
+)
+
+// Everything needed to record visits, only the recorder is required
+type VisitTracker struct {
+	Recorder recorder.Recorder
+	Geo      *geoip.Database
+	Privacy  *privacy.Policy
+}
+
+func RecordVisit(tracker VisitTracker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Next()
 
@@ -80,22 +102,124 @@ func RecordVisit(queries *db.Queries) gin.HandlerFunc {
 			return
 		}
 
-		linkId := link.(db.Link).ID
+		action := tracker.Privacy.Action(c.Request.Header)
+		if action == privacy.Skip {
+			return
+		}
+
 		ip := c.ClientIP()
 		userAgent := c.Request.UserAgent()
-		referer := c.Request.Header.Get("Referer")
-		status := c.Writer.Status()
+		referer := tracker.Privacy.Referer(c.Request.Header.Get("Referer"))
+		parsed := useragent.Parse(userAgent)
+		// Located by the real address, only the anonymized one is stored. Geo targeted redirects have done it already.
+		location, located := c.Value("location").(geoip.Location)
+		if !located {
+			location = tracker.Geo.Lookup(ip)
+		}
 
-		_, err := queries.CreateVisit(c, db.CreateVisitParams{
-			LinkID:    linkId,
-			Ip:        sql.NullString{String: ip, Valid: ip != ""},
-			UserAgent: sql.NullString{String: userAgent, Valid: userAgent != ""},
-			Referer:   sql.NullString{String: referer, Valid: referer != ""},
-			Status:    int16(status),
-		})
+		visit := recorder.Visit{
+			LinkID:         link.(db.Link).ID,
+			Ip:             nullString(tracker.Privacy.Ip(ip)),
+			UserAgent:      nullString(truncate(userAgent, maxUserAgentLength)),
+			Referer:        nullString(truncate(referer, maxRefererLength)),
+			Status:         int16(c.Writer.Status()),
+			ClientType:     visitor.Classify(userAgent),
+			Browser:        nullString(truncate(parsed.Browser, 64)),
+			BrowserVersion: nullString(truncate(parsed.BrowserVersion, 32)),
+			Os:             nullString(truncate(parsed.Os, 64)),
+			OsVersion:      nullString(truncate(parsed.OsVersion, 32)),
+			Device:         nullString(parsed.Device),
+			Country:        nullString(location.Country),
+			Region:         nullString(truncate(location.Region, 128)),
+			City:           nullString(truncate(location.City, 128)),
+			Target:         nullString(c.GetString("target")),
+			Variant:        nullString(c.GetString("variant")),
+			CreatedAt:      time.Now(),
+		}
+
+		// Keeps only coarse data that can't identify the visitor
+		if action == privacy.Minimize {
+			visit.Ip = sql.NullString{}
+			visit.UserAgent = sql.NullString{}
+			visit.Referer = sql.NullString{}
+			visit.BrowserVersion = sql.NullString{}
+			visit.OsVersion = sql.NullString{}
+			visit.Region = sql.NullString{}
+			visit.City = sql.NullString{}
+		}
 
+		tracker.Recorder.Record(visit)
+	}
+}
+
+func ApiKeyAuth(queries *db.Queries) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := getApiKey(c)
+
+		if key == "" {
+			sendError(http.StatusUnauthorized, ErrorUnauthorized, c)
+			c.Abort()
+			return
+		}
+
+		row, err := queries.GetActiveApiKeyByHash(c, internal.HashApiKey(key))
 		if err != nil {
-			handleDbError(err, c)
+			if errors.Is(err, sql.ErrNoRows) {
+				sendError(http.StatusUnauthorized, ErrorUnauthorized, c)
+			} else {
+				sendServerError(c)
+			}
+
+			c.Abort()
+			return
 		}
+
+		c.Set("api_key", row.ApiKey)
+		c.Set("user", row.User)
+		c.Set("workspace", row.Workspace)
+		c.Next()
+	}
+}
+
+func getApiKey(c *gin.Context) string {
+	if key := c.GetHeader("Api-Key"); key != "" {
+		return key
+	}
+
+	authorization := c.GetHeader("Authorization")
+	if token, found := strings.CutPrefix(authorization, "Bearer "); found {
+		return strings.TrimSpace(token)
+	}
+
+	return ""
+}
+
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+var roleLevels = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+func IsValidRole(role string) bool {
+	_, exists := roleLevels[role]
+	return exists
+}
+
+// Roles are ordered: editors can do everything viewers can, admins everything editors can
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if roleLevels[currentUser(c).Role] < roleLevels[role] {
+			sendError(http.StatusForbidden, ErrorForbidden, c)
+			c.Abort()
+			return
+		}
+
+		c.Next()
 	}
 }
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"html/template"
+)
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: sans-serif; max-width: 32rem; margin: 4rem auto; padding: 0 1rem; color: #222; }
+h1 { font-size: 1.5rem; }
+input, button { font-size: 1rem; padding: .4rem .6rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+{{ if .Message }}<p>{{ .Message }}</p>{{ end }}
+{{ if .Error }}<p class="error">{{ .Error }}</p>{{ end }}
+{{ if .PasswordForm }}
+<form method="post">
+<input type="password" name="password" placeholder="Password" autocomplete="current-password" autofocus required>
+<button type="submit">Continue</button>
+</form>
+{{ end }}
+</body>
+</html>
+`))
+
+type page struct {
+	Title        string
+	Message      string
+	Error        string
+	PasswordForm bool
+}
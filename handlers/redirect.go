@@ -1,35 +1,460 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
 
 	db "github.com/darkartx/go-project-278/db/generated"
+	"github.com/darkartx/go-project-278/internal/jsoncolumn"
+	"github.com/darkartx/go-project-278/internal/schedule"
+	"github.com/darkartx/go-project-278/internal/targeting"
+	"github.com/darkartx/go-project-278/internal/throttle"
+	"github.com/darkartx/go-project-278/internal/variant"
+	"github.com/darkartx/go-project-278/internal/visitor"
 )
 
+const (
+	DefaultRedirectType = http.StatusFound
+
+	// Visits redirected by a schedule entry are recorded with it as target
+	scheduleTarget = "schedule"
+
+	variantCookiePrefix = "variant_"
+	variantCookieMaxAge = 30 * 24 * 60 * 60
+
+	// Password attempts from one address lock the link for it until none was tried for passwordLockout,
+	// a correct password starts over
+	passwordAttempts = 5
+	passwordLockout  = 15 * time.Minute
+	passwordClients  = 10000
+)
+
+// RoutedLink is a link with its destination rules decoded, the link cache keeps it so redirects don't decode
+// the rules or compile the targeting patterns again
+type RoutedLink struct {
+	db.Link
+	schedule  []schedule.Entry
+	targeting targeting.Matcher
+	variants  []variant.Variant
+}
+
+// Unreadable rules are logged and left out
+func newRoutedLink(link db.Link) RoutedLink {
+	result := RoutedLink{Link: link}
+	var err error
+
+	if result.schedule, err = jsoncolumn.Decode[[]schedule.Entry](link.Schedule); err != nil {
+		log.Printf("link %d schedule: %v", link.ID, err)
+	}
+
+	rules, err := jsoncolumn.Decode[targeting.Rules](link.Targeting)
+	if err == nil {
+		result.targeting, err = rules.Compile()
+	}
+	if err != nil {
+		log.Printf("link %d targeting: %v", link.ID, err)
+	}
+
+	if result.variants, err = jsoncolumn.Decode[[]variant.Variant](link.Variants); err != nil {
+		log.Printf("link %d variants: %v", link.ID, err)
+	}
+
+	return result
+}
+
+// isDynamic reports whether a visit can end elsewhere than the previous one: the destination depends on the time
+// or on the visitor, or the link stops redirecting when it expires or runs out of visits
+func (l RoutedLink) isDynamic() bool {
+	return len(l.schedule) > 0 || !l.targeting.IsEmpty() || len(l.variants) > 0 || l.ExpiresAt.Valid || l.MaxVisits.Valid
+}
+
 type RedirectHandler struct {
-	queries *db.Queries
+	queries      *db.Queries
+	links        *LinkCache
+	tracker      VisitTracker
+	redirectType int
+	passwords    *throttle.Limiter
 }
 
-func NewRedirectHandler(queries *db.Queries) *RedirectHandler {
-	return &RedirectHandler{queries: queries}
+// redirectType is used for links without their own, zero means DefaultRedirectType
+func NewRedirectHandler(queries *db.Queries, links *LinkCache, tracker VisitTracker, redirectType int) *RedirectHandler {
+	if redirectType == 0 {
+		redirectType = DefaultRedirectType
+	}
+
+	return &RedirectHandler{
+		queries:      queries,
+		links:        links,
+		tracker:      tracker,
+		redirectType: redirectType,
+		passwords:    throttle.New(passwordAttempts, passwordLockout, passwordClients),
+	}
 }
 
 func (h *RedirectHandler) Register(r *gin.Engine) {
-	r.GET("/r/:code", RecordVisit(h.queries), h.Get)
+	r.GET("/r/:code", RecordVisit(h.tracker), h.Get)
+	r.POST("/r/:code", RecordVisit(h.tracker), h.Post)
+	r.GET("/r/:code/*rest", RecordVisit(h.tracker), h.Get)
+	r.POST("/r/:code/*rest", RecordVisit(h.tracker), h.Post)
 }
 
 func (h *RedirectHandler) Get(c *gin.Context) {
+	link, ok := h.findLink(c)
+	if !ok {
+		return
+	}
+
+	if link.PasswordHash.Valid {
+		sendPasswordForm(http.StatusOK, nil, c)
+		return
+	}
+
+	h.redirect(link, h.linkRedirectType(link), c)
+}
+
+func (h *RedirectHandler) Post(c *gin.Context) {
+	link, ok := h.findLink(c)
+	if !ok {
+		return
+	}
+
+	if link.PasswordHash.Valid {
+		key := fmt.Sprintf("%d/%s", link.ID, c.ClientIP())
+
+		if wait, ok := h.passwords.Attempt(key); !ok {
+			c.Set("link", link.Link)
+			c.Header("Retry-After", strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+			sendPasswordForm(http.StatusTooManyRequests, ErrorTooManyAttempts, c)
+			return
+		}
+
+		if !checkPassword(link.PasswordHash.String, c.PostForm("password")) {
+			c.Set("link", link.Link)
+			sendPasswordForm(http.StatusUnauthorized, ErrorInvalidPassword, c)
+			return
+		}
+
+		h.passwords.Reset(key)
+	}
+
+	// After a form submission the browser must follow up with a GET
+	h.redirect(link, http.StatusSeeOther, c)
+}
+
+func (h *RedirectHandler) findLink(c *gin.Context) (RoutedLink, bool) {
 	shortName := c.Param("code")
 
-	link, err := h.queries.GetLinkByShortName(c, shortName)
+	link, err := h.links.GetLinkByShortName(c, db.GetLinkByShortNameParams{
+		ShortName: shortName,
+		Domain:    nullString(getRequestDomain(c)),
+	})
 
 	if err != nil {
 		handleDbError(err, c)
-		return
+		return RoutedLink{}, false
 	}
 
-	c.Set("link", link)
-	c.Redirect(http.StatusFound, link.OriginalUrl)
+	if link.DeletedAt.Valid {
+		c.Set("link", link.Link)
+		sendGone(ErrorLinkDeleted, c)
+		return RoutedLink{}, false
+	}
+
+	// Only links forwarding the path serve deep paths
+	if !link.ForwardPath && forwardedPath(c) != "" {
+		sendNotFound(c)
+		return RoutedLink{}, false
+	}
+
+	if isLinkExpired(link.Link, time.Now()) {
+		c.Set("link", link.Link)
+
+		if link.ExpiredUrl.Valid {
+			c.Redirect(http.StatusFound, link.ExpiredUrl.String)
+			return RoutedLink{}, false
+		}
+
+		sendGone(ErrorLinkExpired, c)
+		return RoutedLink{}, false
+	}
+
+	return link, true
+}
+
+func (h *RedirectHandler) redirect(link RoutedLink, code int, c *gin.Context) {
+	c.Set("link", link.Link)
+
+	if link.MaxVisits.Valid {
+		consume := h.queries.ConsumeLinkVisit
+		// Link previews and crawlers don't use up visits, they are only turned away once none are left
+		if visitor.Classify(c.Request.UserAgent()) == visitor.Bot {
+			consume = h.queries.PeekLinkVisit
+		}
+
+		if _, err := consume(c, link.ID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				sendGone(ErrorLinkVisitsExceeded, c)
+				return
+			}
+
+			handleDbError(err, c)
+			return
+		}
+	}
+
+	// Browsers must ask again on every visit, a cached redirect would keep returning visitors on the first destination
+	if link.isDynamic() {
+		c.Header("Cache-Control", "no-store")
+	}
+
+	c.Redirect(code, destinationUrl(link.Link, h.targetUrl(link, c), c))
+}
+
+// targetUrl is the destination of the active schedule entry of the link, otherwise the one picked by its targeting
+// rules, then by its variants, the original url when there are none. The matched rule and variant are kept in the
+// context for the visit.
+func (h *RedirectHandler) targetUrl(link RoutedLink, c *gin.Context) string {
+	if url, ok := activeSchedule(link, c); ok {
+		return url
+	}
+
+	if url, ok := h.matchTargeting(link, c); ok {
+		return url
+	}
+
+	if url, ok := pickVariant(link, c); ok {
+		return url
+	}
+
+	return link.OriginalUrl
+}
+
+func activeSchedule(link RoutedLink, c *gin.Context) (string, bool) {
+	index, entry, ok := schedule.Active(link.schedule, time.Now())
+	if !ok {
+		return "", false
+	}
+
+	c.Set("target", fmt.Sprintf("%s:%d", scheduleTarget, index))
+	return entry.Url, true
+}
+
+func (h *RedirectHandler) matchTargeting(link RoutedLink, c *gin.Context) (string, bool) {
+	rules := link.targeting
+
+	var country string
+	if rules.HasCountries() {
+		// Looked up once, the visit reuses it
+		location := h.tracker.Geo.Lookup(c.ClientIP())
+		c.Set("location", location)
+		country = location.Country
+	}
+
+	target, ok := rules.Match(c.Request.UserAgent(), country)
+	if !ok {
+		return "", false
+	}
+
+	c.Set("target", target.Name)
+	return target.Url, true
+}
+
+// pickVariant picks a variant of the link by weight, sticky links keep returning visitors on theirs with a cookie
+func pickVariant(link RoutedLink, c *gin.Context) (string, bool) {
+	variants := link.variants
+	if len(variants) == 0 {
+		return "", false
+	}
+
+	cookie := fmt.Sprintf("%s%d", variantCookiePrefix, link.ID)
+
+	var picked variant.Variant
+	var ok bool
+
+	if link.StickyVariants {
+		if name, err := c.Cookie(cookie); err == nil {
+			picked, ok = variant.Find(variants, name)
+		}
+	}
+
+	if !ok {
+		if picked, ok = variant.Choose(variants); !ok {
+			return "", false
+		}
+
+		if link.StickyVariants {
+			c.SetCookie(cookie, picked.Name, variantCookieMaxAge, "/", "", c.Request.TLS != nil, true)
+		}
+	}
+
+	c.Set("variant", picked.Name)
+	return picked.Url, true
+}
+
+// destinationUrl is the target url with the utm parameters of the link, and the path and query of the request
+// forwarded when the link asks for it
+func destinationUrl(link db.Link, target string, c *gin.Context) string {
+	utm := utmQuery(link)
+	forwardQuery := link.ForwardQuery && c.Request.URL.RawQuery != ""
+
+	var rest string
+	if link.ForwardPath {
+		rest = forwardedPath(c)
+	}
+
+	if len(utm) == 0 && !forwardQuery && rest == "" {
+		return target
+	}
+
+	result, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+
+	if rest != "" {
+		result.Path = strings.TrimSuffix(result.Path, "/") + rest
+		result.RawPath = ""
+	}
+
+	// Utm parameters of the link override the ones of the target url, values of the request override both
+	if len(utm) > 0 || forwardQuery {
+		var forwarded string
+		if forwardQuery {
+			forwarded = c.Request.URL.RawQuery
+		}
+
+		result.RawQuery = mergeQuery(result.RawQuery, utm, forwarded)
+	}
+
+	return result.String()
+}
+
+// mergeQuery keeps the pairs of the target query as they are written, only dropping the keys set by utm or by
+// the forwarded request query, so signed urls and repeated keys survive. The forwarded query is appended verbatim.
+func mergeQuery(target string, utm url.Values, forwarded string) string {
+	overridden := map[string]bool{}
+	for key := range utm {
+		overridden[key] = true
+	}
+
+	forwardedQuery, _ := url.ParseQuery(forwarded)
+	for key := range forwardedQuery {
+		overridden[key] = true
+	}
+
+	added := url.Values{}
+	for key, values := range utm {
+		if _, ok := forwardedQuery[key]; !ok {
+			added[key] = values
+		}
+	}
+
+	var parts []string
+	for _, pair := range strings.Split(target, "&") {
+		if pair == "" {
+			continue
+		}
+
+		key, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil && overridden[unescaped] {
+			continue
+		}
+
+		parts = append(parts, pair)
+	}
+
+	if len(added) > 0 {
+		parts = append(parts, added.Encode())
+	}
+
+	if forwarded != "" {
+		parts = append(parts, forwarded)
+	}
+
+	return strings.Join(parts, "&")
+}
+
+func utmQuery(link db.Link) url.Values {
+	query := url.Values{}
+
+	for key, value := range map[string]sql.NullString{
+		"utm_source":   link.UtmSource,
+		"utm_medium":   link.UtmMedium,
+		"utm_campaign": link.UtmCampaign,
+		"utm_term":     link.UtmTerm,
+		"utm_content":  link.UtmContent,
+	} {
+		if value.Valid && value.String != "" {
+			query.Set(key, value.String)
+		}
+	}
+
+	return query
+}
+
+// forwardedPath is the cleaned request path after the code, dot segments can't climb above the original path
+func forwardedPath(c *gin.Context) string {
+	rest := c.Param("rest")
+	if rest == "" || rest == "/" {
+		return ""
+	}
+
+	cleaned := path.Clean(rest)
+	if cleaned == "/" {
+		return ""
+	}
+
+	if strings.HasSuffix(rest, "/") {
+		cleaned += "/"
+	}
+
+	return cleaned
+}
+
+// Links with a destination picked per visit never redirect permanently, whatever their redirect type
+func (h *RedirectHandler) linkRedirectType(link RoutedLink) int {
+	code := h.redirectType
+	if link.RedirectType.Valid {
+		code = int(link.RedirectType.Int16)
+	}
+
+	if link.isDynamic() {
+		switch code {
+		case http.StatusMovedPermanently:
+			return http.StatusFound
+		case http.StatusPermanentRedirect:
+			return http.StatusTemporaryRedirect
+		}
+	}
+
+	return code
+}
+
+// IsRedirectType reports whether the code can be used as a link redirect type
+func IsRedirectType(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+
+	return false
+}
+
+func isLinkExpired(link db.Link, now time.Time) bool {
+	return link.ExpiresAt.Valid && !now.Before(link.ExpiresAt.Time)
+}
+
+func checkPassword(hash string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
 }
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestMergeQuery(t *testing.T) {
+	cases := []struct {
+		name      string
+		target    string
+		utm       url.Values
+		forwarded string
+		expected  string
+	}{
+		{"forwarded appended verbatim", "sig=A%2Fb&a=2&a=1", nil, "z=1&y=%7E", "sig=A%2Fb&a=2&a=1&z=1&y=%7E"},
+		{"forwarded overrides target", "lang=en&ref=short", nil, "utm_source=x&lang=de", "ref=short&utm_source=x&lang=de"},
+		{"utm overrides target", "utm_source=old&lang=en", url.Values{"utm_source": {"new"}, "utm_medium": {"email"}}, "", "lang=en&utm_medium=email&utm_source=new"},
+		{"forwarded overrides utm", "lang=en", url.Values{"utm_source": {"new"}}, "utm_source=x", "lang=en&utm_source=x"},
+		{"empty target", "", nil, "a=1", "a=1"},
+	}
+
+	for _, caseItem := range cases {
+		if actual := mergeQuery(caseItem.target, caseItem.utm, caseItem.forwarded); actual != caseItem.expected {
+			t.Errorf("%s: mergeQuery() = %q; want %q", caseItem.name, actual, caseItem.expected)
+		}
+	}
+}
@@ -1,10 +1,16 @@
 package handlers
 
 import (
+	"database/sql"
 	"fmt"
+	"net"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+
+	db "github.com/darkartx/go-project-278/db/generated"
 )
 
 func parseId(c *gin.Context) (uint64, error) {
@@ -16,25 +22,90 @@ func parseId(c *gin.Context) (uint64, error) {
 	return id, nil
 }
 
-func getBaseUrl(c *gin.Context) string {
-	result := c.Request.Header.Get("Referer")
+func currentUser(c *gin.Context) db.User {
+	return c.MustGet("user").(db.User)
+}
 
-	if result != "" {
-		return result
+func currentWorkspace(c *gin.Context) db.Workspace {
+	return c.MustGet("workspace").(db.Workspace)
+}
+
+// Request host without port, used to find the workspace bound to a custom domain
+func getRequestDomain(c *gin.Context) string {
+	host := c.Request.Host
+
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
 	}
 
-	scheme := "http"
+	return strings.ToLower(host)
+}
 
+func getScheme(c *gin.Context) string {
 	if c.Request.Header.Get("X-Forwarded-Proto") == "https" {
-		scheme = "https"
+		return "https"
 	} else if c.Request.TLS != nil {
-		scheme = "https"
+		return "https"
 	}
 
-	return fmt.Sprintf("%s://%s/", scheme, c.Request.Host)
+	return "http"
+}
+
+func getBaseUrl(c *gin.Context) string {
+	if value, exists := c.Get("workspace"); exists {
+		if workspace := value.(db.Workspace); workspace.Domain.Valid {
+			return fmt.Sprintf("%s://%s/", getScheme(c), workspace.Domain.String)
+		}
+	}
+
+	result := c.Request.Header.Get("Referer")
+
+	if result != "" {
+		return result
+	}
+
+	return fmt.Sprintf("%s://%s/", getScheme(c), c.Request.Host)
 }
 
 func makeShortUrl(shortName string, c *gin.Context) string {
 	baseUrl := getBaseUrl(c)
 	return fmt.Sprint(baseUrl, "r/", shortName)
 }
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// Cuts value to max characters to fit the column
+func truncate(value string, max int) string {
+	runes := []rune(value)
+	if len(runes) <= max {
+		return value
+	}
+
+	return string(runes[:max])
+}
+
+func nullTime(value *time.Time) sql.NullTime {
+	if value == nil {
+		return sql.NullTime{}
+	}
+
+	return sql.NullTime{Time: *value, Valid: true}
+}
+
+func nullInt16(value *int16) sql.NullInt16 {
+	if value == nil {
+		return sql.NullInt16{}
+	}
+
+	return sql.NullInt16{Int16: *value, Valid: true}
+}
+
+func nullInt32(value *int32) sql.NullInt32 {
+	if value == nil {
+		return sql.NullInt32{}
+	}
+
+	return sql.NullInt32{Int32: *value, Valid: true}
+}
@@ -0,0 +1,27 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const (
+	apiKeyBytes     = 32
+	ApiKeyPrefixLen = 8
+)
+
+func GenerateApiKey() (string, error) {
+	bytes := make([]byte, apiKeyBytes)
+
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(bytes), nil
+}
+
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
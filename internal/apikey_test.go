@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"testing"
+)
+
+func TestGenerateApiKey(t *testing.T) {
+	first, err := GenerateApiKey()
+	if err != nil {
+		t.Fatalf("GenerateApiKey() error: %v", err)
+	}
+
+	second, err := GenerateApiKey()
+	if err != nil {
+		t.Fatalf("GenerateApiKey() error: %v", err)
+	}
+
+	if len(first) != apiKeyBytes*2 {
+		t.Errorf("GenerateApiKey() = length %d; want %d", len(first), apiKeyBytes*2)
+	}
+
+	if first == second {
+		t.Errorf("GenerateApiKey() returned the same key twice: %s", first)
+	}
+}
+
+func TestHashApiKey(t *testing.T) {
+	tests := []struct {
+		key, hash string
+	}{
+		{"", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+
+	for _, tt := range tests {
+		if hash := HashApiKey(tt.key); hash != tt.hash {
+			t.Errorf("HashApiKey(%q) = %s; want %s", tt.key, hash, tt.hash)
+		}
+	}
+}
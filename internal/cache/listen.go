@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+// Listen subscribes to a Postgres NOTIFY channel on a dedicated connection and calls onNotify
+// with every payload. Notifications sent while disconnected are lost, so onConnect is called
+// after every (re)connect to let the caller drop whatever it may have missed.
+// Blocks until ctx is done.
+func Listen(ctx context.Context, databaseUrl string, channel string, onConnect func(), onNotify func(payload string)) {
+	delay := minReconnectDelay
+
+	for ctx.Err() == nil {
+		err := listen(ctx, databaseUrl, channel, func() {
+			delay = minReconnectDelay
+			onConnect()
+		}, onNotify)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("listen %s: %v, reconnecting in %s", channel, err, delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+func listen(ctx context.Context, databaseUrl string, channel string, onConnect func(), onNotify func(payload string)) error {
+	conn, err := pgx.Connect(ctx, databaseUrl)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = conn.Close(context.Background())
+	}()
+
+	if _, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return err
+	}
+
+	onConnect()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		onNotify(notification.Payload)
+	}
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int](2, time.Minute)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Set("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("Get(b) found; want evicted")
+	}
+
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if value, ok := c.Get(key); !ok || value != want {
+			t.Errorf("Get(%s) = %d, %t; want %d, true", key, value, ok, want)
+		}
+	}
+
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d; want 2", c.Len())
+	}
+}
+
+func TestLRUExpires(t *testing.T) {
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	c := New[string, int](2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Set("a", 1)
+
+	now = now.Add(30 * time.Second)
+	if _, ok := c.Get("a"); !ok {
+		t.Errorf("Get(a) not found before ttl")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Get(a) found after ttl")
+	}
+
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d; want 0", c.Len())
+	}
+}
+
+func TestLRURemove(t *testing.T) {
+	c := New[string, int](10, time.Minute)
+
+	for i, key := range []string{"a", "b", "c", "d"} {
+		c.Set(key, i)
+	}
+
+	c.Remove("a")
+
+	if removed := c.RemoveFunc(func(key string, value int) bool { return value%2 == 1 }); removed != 2 {
+		t.Errorf("RemoveFunc() = %d; want 2", removed)
+	}
+
+	if value, ok := c.Get("c"); !ok || value != 2 {
+		t.Errorf("Get(c) = %d, %t; want 2, true", value, ok)
+	}
+
+	c.Purge()
+
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d; want 0", c.Len())
+	}
+}
+
+func TestLRUWithZeroCapacity(t *testing.T) {
+	c := New[string, int](0, time.Minute)
+	c.Set("a", 1)
+
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Get(a) found in disabled cache")
+	}
+}
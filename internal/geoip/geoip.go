@@ -0,0 +1,79 @@
+package geoip
+
+import (
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+type Location struct {
+	Country string
+	Region  string
+	City    string
+}
+
+// Database resolves ips with a local MaxMind (.mmdb) City or Country database.
+// A nil Database resolves nothing, so lookups can stay unconditional when it isn't configured.
+type Database struct {
+	reader *maxminddb.Reader
+}
+
+type record struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+func Open(path string) (*Database, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Database{reader: reader}, nil
+}
+
+func (d *Database) Close() error {
+	if d == nil {
+		return nil
+	}
+
+	return d.reader.Close()
+}
+
+func (d *Database) Lookup(ip string) Location {
+	if d == nil {
+		return Location{}
+	}
+
+	address := net.ParseIP(ip)
+	if address == nil {
+		return Location{}
+	}
+
+	var result record
+	if err := d.reader.Lookup(address, &result); err != nil {
+		return Location{}
+	}
+
+	location := Location{
+		Country: result.Country.IsoCode,
+		City:    result.City.Names["en"],
+	}
+
+	if len(result.Subdivisions) > 0 {
+		location.Region = result.Subdivisions[0].Names["en"]
+		if location.Region == "" {
+			location.Region = result.Subdivisions[0].IsoCode
+		}
+	}
+
+	return location
+}
@@ -0,0 +1,39 @@
+package geoip
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	database, err := Open("testdata/GeoIP2-City-Test.mmdb")
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+
+	defer func() {
+		_ = database.Close()
+	}()
+
+	tests := []struct {
+		ip   string
+		want Location
+	}{
+		{"81.2.69.142", Location{"GB", "England", "London"}},
+		{"2001:db8::1", Location{"DE", "", ""}},
+		{"10.0.0.1", Location{}},
+		{"invalid", Location{}},
+		{"", Location{}},
+	}
+
+	for _, tt := range tests {
+		if got := database.Lookup(tt.ip); got != tt.want {
+			t.Errorf("Lookup(%q) = %+v; want %+v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestLookupWithoutDatabase(t *testing.T) {
+	var database *Database
+
+	if got := database.Lookup("81.2.69.142"); got != (Location{}) {
+		t.Errorf("Lookup() = %+v; want empty location", got)
+	}
+}
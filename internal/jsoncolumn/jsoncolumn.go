@@ -0,0 +1,20 @@
+// Package jsoncolumn reads values kept in JSONB columns of links, like targeting rules, variants and schedules
+package jsoncolumn
+
+import "encoding/json"
+
+// Decode reads a value stored as json, empty input gives the zero value
+func Decode[T any](data []byte) (T, error) {
+	var value T
+
+	if len(data) == 0 {
+		return value, nil
+	}
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		var empty T
+		return empty, err
+	}
+
+	return value, nil
+}
@@ -0,0 +1,22 @@
+package jsoncolumn
+
+import "testing"
+
+type item struct {
+	Name string `json:"name"`
+}
+
+func TestDecode(t *testing.T) {
+	items, err := Decode[[]item]([]byte(`[{"name":"a"}]`))
+	if err != nil || len(items) != 1 || items[0].Name != "a" {
+		t.Errorf("Decode() = %+v, %v", items, err)
+	}
+
+	if items, err = Decode[[]item](nil); err != nil || items != nil {
+		t.Errorf("Decode(nil) = %+v, %v; want nil", items, err)
+	}
+
+	if value, err := Decode[item]([]byte(`[]`)); err == nil || value != (item{}) {
+		t.Errorf("Decode([]) = %+v, %v; want error", value, err)
+	}
+}
@@ -0,0 +1,151 @@
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+const (
+	IpFull     = "full"
+	IpTruncate = "truncate"
+	IpHash     = "hash"
+
+	DntIgnore   = "ignore"
+	DntMinimize = "minimize"
+	DntSkip     = "skip"
+
+	RefererFull   = "full"
+	RefererOrigin = "origin"
+
+	hashLength = 32
+)
+
+type Action int
+
+const (
+	Record Action = iota
+	Minimize
+	Skip
+)
+
+var (
+	ErrorInvalidMode = errors.New("invalid privacy mode")
+	ErrorMissingSalt = errors.New("ip hash mode requires a salt")
+)
+
+type Options struct {
+	IpMode      string
+	DntMode     string
+	RefererMode string
+	// Secret of the ip hashes, required by IpHash and shared by every instance so they hash an address alike
+	Salt string
+}
+
+// Policy decides what of a visit is stored. A nil Policy stores everything as is.
+type Policy struct {
+	options Options
+	secret  []byte
+	now     func() time.Time
+}
+
+func New(options Options) (*Policy, error) {
+	if options.IpMode == "" {
+		options.IpMode = IpFull
+	}
+
+	if options.DntMode == "" {
+		options.DntMode = DntIgnore
+	}
+
+	if options.RefererMode == "" {
+		options.RefererMode = RefererFull
+	}
+
+	if !slices.Contains([]string{IpFull, IpTruncate, IpHash}, options.IpMode) {
+		return nil, fmt.Errorf("%w: ip %s", ErrorInvalidMode, options.IpMode)
+	}
+
+	if !slices.Contains([]string{DntIgnore, DntMinimize, DntSkip}, options.DntMode) {
+		return nil, fmt.Errorf("%w: dnt %s", ErrorInvalidMode, options.DntMode)
+	}
+
+	if !slices.Contains([]string{RefererFull, RefererOrigin}, options.RefererMode) {
+		return nil, fmt.Errorf("%w: referer %s", ErrorInvalidMode, options.RefererMode)
+	}
+
+	if options.IpMode == IpHash && options.Salt == "" {
+		return nil, ErrorMissingSalt
+	}
+
+	return &Policy{options: options, secret: []byte(options.Salt), now: time.Now}, nil
+}
+
+// Action tells how to record a visit of a client asking not to be tracked with DNT or Sec-GPC
+func (p *Policy) Action(header http.Header) Action {
+	if p == nil || p.options.DntMode == DntIgnore {
+		return Record
+	}
+
+	if header.Get("DNT") != "1" && header.Get("Sec-GPC") != "1" {
+		return Record
+	}
+
+	if p.options.DntMode == DntSkip {
+		return Skip
+	}
+
+	return Minimize
+}
+
+// Ip anonymizes the address: IPv4 is cut to /24 and IPv6 to /48, or replaced with a hash
+// salted with a key rotated daily, so the same visitor can be counted within a day only
+func (p *Policy) Ip(ip string) string {
+	if p == nil || ip == "" || p.options.IpMode == IpFull {
+		return ip
+	}
+
+	address := net.ParseIP(ip)
+	if address == nil {
+		return ""
+	}
+
+	if p.options.IpMode == IpHash {
+		day := p.now().UTC().Format("2006-01-02")
+
+		key := hmac.New(sha256.New, p.secret)
+		key.Write([]byte(day))
+
+		hash := hmac.New(sha256.New, key.Sum(nil))
+		hash.Write([]byte(address.String()))
+
+		return hex.EncodeToString(hash.Sum(nil))[:hashLength]
+	}
+
+	if v4 := address.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+
+	return address.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// Referer drops the path and query of the referer in the origin mode
+func (p *Policy) Referer(referer string) string {
+	if p == nil || referer == "" || p.options.RefererMode == RefererFull {
+		return referer
+	}
+
+	parsed, err := url.Parse(referer)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+
+	return parsed.Scheme + "://" + parsed.Host + "/"
+}
@@ -0,0 +1,140 @@
+package privacy
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIp(t *testing.T) {
+	tests := []struct {
+		mode, ip, want string
+	}{
+		{IpFull, "81.2.69.142", "81.2.69.142"},
+		{IpTruncate, "81.2.69.142", "81.2.69.0"},
+		{IpTruncate, "::ffff:81.2.69.142", "81.2.69.0"},
+		{IpTruncate, "2001:db8:85a3:8d3:1319:8a2e:370:7348", "2001:db8:85a3::"},
+		{IpTruncate, "invalid", ""},
+		{IpTruncate, "", ""},
+	}
+
+	for _, tt := range tests {
+		policy, err := New(Options{IpMode: tt.mode})
+		if err != nil {
+			t.Fatalf("New() error: %v", err)
+		}
+
+		if got := policy.Ip(tt.ip); got != tt.want {
+			t.Errorf("Ip(%q) with %s = %q; want %q", tt.ip, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestIpHash(t *testing.T) {
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+
+	policy, err := New(Options{IpMode: IpHash, Salt: "secret"})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	policy.now = func() time.Time { return now }
+
+	first := policy.Ip("81.2.69.142")
+	if len(first) != hashLength || first == "81.2.69.142" {
+		t.Errorf("Ip() = %q; want a hash of %d characters", first, hashLength)
+	}
+
+	if second := policy.Ip("81.2.69.142"); second != first {
+		t.Errorf("Ip() = %q within a day; want %q", second, first)
+	}
+
+	if other := policy.Ip("81.2.69.143"); other == first {
+		t.Errorf("Ip() of different addresses are equal")
+	}
+
+	now = now.Add(24 * time.Hour)
+	if next := policy.Ip("81.2.69.142"); next == first {
+		t.Errorf("Ip() didn't change on the next day")
+	}
+}
+
+func TestAction(t *testing.T) {
+	tests := []struct {
+		mode   string
+		header map[string]string
+		want   Action
+	}{
+		{DntIgnore, map[string]string{"DNT": "1"}, Record},
+		{DntMinimize, map[string]string{}, Record},
+		{DntMinimize, map[string]string{"DNT": "0"}, Record},
+		{DntMinimize, map[string]string{"DNT": "1"}, Minimize},
+		{DntMinimize, map[string]string{"Sec-GPC": "1"}, Minimize},
+		{DntSkip, map[string]string{"DNT": "1"}, Skip},
+	}
+
+	for _, tt := range tests {
+		policy, err := New(Options{DntMode: tt.mode})
+		if err != nil {
+			t.Fatalf("New() error: %v", err)
+		}
+
+		header := http.Header{}
+		for key, value := range tt.header {
+			header.Set(key, value)
+		}
+
+		if got := policy.Action(header); got != tt.want {
+			t.Errorf("Action(%v) with %s = %d; want %d", tt.header, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestReferer(t *testing.T) {
+	policy, err := New(Options{RefererMode: RefererOrigin})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	tests := []struct {
+		referer, want string
+	}{
+		{"https://example.com/private/page?token=1", "https://example.com/"},
+		{"http://localhost:8080/", "http://localhost:8080/"},
+		{"not a url", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Referer(tt.referer); got != tt.want {
+			t.Errorf("Referer(%q) = %q; want %q", tt.referer, got, tt.want)
+		}
+	}
+}
+
+func TestNilPolicy(t *testing.T) {
+	var policy *Policy
+
+	if got := policy.Ip("81.2.69.142"); got != "81.2.69.142" {
+		t.Errorf("Ip() = %q; want the address as is", got)
+	}
+
+	if got := policy.Action(http.Header{"Dnt": []string{"1"}}); got != Record {
+		t.Errorf("Action() = %d; want Record", got)
+	}
+}
+
+func TestNewWithInvalidMode(t *testing.T) {
+	for _, options := range []Options{{IpMode: "mask"}, {DntMode: "drop"}, {RefererMode: "host"}} {
+		if _, err := New(options); !errors.Is(err, ErrorInvalidMode) {
+			t.Errorf("New(%+v) error = %v; want %v", options, err, ErrorInvalidMode)
+		}
+	}
+}
+
+func TestNewWithoutSalt(t *testing.T) {
+	if _, err := New(Options{IpMode: IpHash}); !errors.Is(err, ErrorMissingSalt) {
+		t.Errorf("New() error = %v; want %v", err, ErrorMissingSalt)
+	}
+}
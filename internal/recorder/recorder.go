@@ -0,0 +1,342 @@
+package recorder
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	db "github.com/darkartx/go-project-278/db/generated"
+	"github.com/darkartx/go-project-278/internal/visitor"
+)
+
+const (
+	DefaultQueueSize     = 10000
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = time.Second
+	DefaultWorkers       = 2
+
+	flushTimeout  = 10 * time.Second
+	flushAttempts = 3
+	retryDelay    = 100 * time.Millisecond
+)
+
+var ErrorClosed = errors.New("recorder closed")
+
+type Visit struct {
+	LinkID         int64
+	Ip             sql.NullString
+	UserAgent      sql.NullString
+	Referer        sql.NullString
+	Status         int16
+	ClientType     string
+	Browser        sql.NullString
+	BrowserVersion sql.NullString
+	Os             sql.NullString
+	OsVersion      sql.NullString
+	Device         sql.NullString
+	Country        sql.NullString
+	Region         sql.NullString
+	City           sql.NullString
+	Target         sql.NullString
+	Variant        sql.NullString
+	CreatedAt      time.Time
+}
+
+type Recorder interface {
+	Record(visit Visit)
+}
+
+type FlushFunc func(ctx context.Context, visits []Visit) error
+
+type Options struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	Workers       int
+}
+
+type Stats struct {
+	Enqueued int64 `json:"enqueued"`
+	Dropped  int64 `json:"dropped"`
+	Flushed  int64 `json:"flushed"`
+	Failed   int64 `json:"failed"`
+	Queued   int   `json:"queued"`
+}
+
+// Writes every visit right away, used by tests and tools
+type SyncRecorder struct {
+	queries *db.Queries
+}
+
+func NewSync(queries *db.Queries) *SyncRecorder {
+	return &SyncRecorder{queries: queries}
+}
+
+func (r *SyncRecorder) Record(visit Visit) {
+	_, err := r.queries.CreateVisit(context.Background(), db.CreateVisitParams{
+		LinkID:         visit.LinkID,
+		Ip:             visit.Ip,
+		UserAgent:      visit.UserAgent,
+		Referer:        visit.Referer,
+		Status:         visit.Status,
+		ClientType:     sql.NullString{String: visit.ClientType, Valid: visit.ClientType != ""},
+		Browser:        visit.Browser,
+		BrowserVersion: visit.BrowserVersion,
+		Os:             visit.Os,
+		OsVersion:      visit.OsVersion,
+		Device:         visit.Device,
+		Country:        visit.Country,
+		Region:         visit.Region,
+		City:           visit.City,
+		Target:         visit.Target,
+		Variant:        visit.Variant,
+	})
+
+	if err != nil {
+		log.Printf("record visit: %v", err)
+	}
+}
+
+// Queues visits and writes them in batches from background workers.
+// Visits are dropped when the queue is full so redirects never wait for the database.
+type BatchRecorder struct {
+	flush   FlushFunc
+	options Options
+	queue   chan Visit
+	mu      sync.RWMutex
+	closed  bool
+	wg      sync.WaitGroup
+
+	enqueued atomic.Int64
+	dropped  atomic.Int64
+	flushed  atomic.Int64
+	failed   atomic.Int64
+}
+
+func NewBatch(flush FlushFunc, options Options) *BatchRecorder {
+	options = options.withDefaults()
+
+	r := &BatchRecorder{
+		flush:   flush,
+		options: options,
+		queue:   make(chan Visit, options.QueueSize),
+	}
+
+	for i := 0; i < options.Workers; i++ {
+		r.wg.Add(1)
+		go r.work()
+	}
+
+	return r
+}
+
+func (r *BatchRecorder) Record(visit Visit) {
+	if visit.CreatedAt.IsZero() {
+		visit.CreatedAt = time.Now()
+	}
+
+	if visit.ClientType == "" {
+		visit.ClientType = visitor.Human
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		r.dropped.Add(1)
+		return
+	}
+
+	select {
+	case r.queue <- visit:
+		r.enqueued.Add(1)
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Stops accepting visits and waits until the queued ones are flushed
+func (r *BatchRecorder) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrorClosed
+	}
+
+	r.closed = true
+	close(r.queue)
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *BatchRecorder) Stats() Stats {
+	return Stats{
+		Enqueued: r.enqueued.Load(),
+		Dropped:  r.dropped.Load(),
+		Flushed:  r.flushed.Load(),
+		Failed:   r.failed.Load(),
+		Queued:   len(r.queue),
+	}
+}
+
+func (r *BatchRecorder) work() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.options.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Visit, 0, r.options.BatchSize)
+
+	for {
+		select {
+		case visit, ok := <-r.queue:
+			if !ok {
+				r.write(batch)
+				return
+			}
+
+			batch = append(batch, visit)
+			if len(batch) >= r.options.BatchSize {
+				r.write(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			r.write(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (r *BatchRecorder) write(batch []Visit) {
+	if len(batch) == 0 {
+		return
+	}
+
+	err := r.flushWithRetry(batch)
+
+	switch {
+	case err == nil:
+		r.flushed.Add(int64(len(batch)))
+	case isDataError(err) && len(batch) > 1:
+		// A single bad row fails the whole batch, the rest is written one by one
+		log.Printf("flush %d visits: %v, writing them one by one", len(batch), err)
+		for _, visit := range batch {
+			r.write([]Visit{visit})
+		}
+	case isDataError(err):
+		r.dropped.Add(1)
+		log.Printf("drop visit of link %d: %v", batch[0].LinkID, err)
+	default:
+		r.failed.Add(int64(len(batch)))
+		log.Printf("flush %d visits: %v", len(batch), err)
+	}
+}
+
+// Transient errors such as deadlocks or a lost connection are retried with a growing delay
+func (r *BatchRecorder) flushWithRetry(batch []Visit) error {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		err := r.flush(ctx, batch)
+		cancel()
+
+		if err == nil || attempt == flushAttempts || !isTransient(err) {
+			return err
+		}
+
+		time.Sleep(time.Duration(attempt) * retryDelay)
+	}
+}
+
+func isTransient(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgerrcode.IsTransactionRollback(pgErr.Code) || pgerrcode.IsConnectionException(pgErr.Code)
+	}
+
+	return errors.Is(err, driver.ErrBadConn) || pgconn.SafeToRetry(err)
+}
+
+// Errors caused by the rows themselves, like a link deleted meanwhile or a value that doesn't fit
+func isDataError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgerrcode.IsDataException(pgErr.Code) || pgerrcode.IsIntegrityConstraintViolation(pgErr.Code)
+	}
+
+	return false
+}
+
+func (o Options) withDefaults() Options {
+	if o.QueueSize <= 0 {
+		o.QueueSize = DefaultQueueSize
+	}
+
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultBatchSize
+	}
+
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = DefaultFlushInterval
+	}
+
+	if o.Workers <= 0 {
+		o.Workers = DefaultWorkers
+	}
+
+	return o
+}
+
+// Writes visits with COPY over a connection of the pgx stdlib driver
+func CopyVisits(database *sql.DB) FlushFunc {
+	columns := []string{
+		"link_id", "ip", "user_agent", "referer", "status", "client_type",
+		"browser", "browser_version", "os", "os_version", "device", "country", "region", "city", "target", "variant", "created_at",
+	}
+
+	return func(ctx context.Context, visits []Visit) error {
+		conn, err := database.Conn(ctx)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		rows := make([][]any, 0, len(visits))
+		for _, visit := range visits {
+			rows = append(rows, []any{
+				visit.LinkID, visit.Ip, visit.UserAgent, visit.Referer, visit.Status, visit.ClientType,
+				visit.Browser, visit.BrowserVersion, visit.Os, visit.OsVersion, visit.Device,
+				visit.Country, visit.Region, visit.City, visit.Target, visit.Variant, visit.CreatedAt,
+			})
+		}
+
+		return conn.Raw(func(driverConn any) error {
+			_, err := driverConn.(*stdlib.Conn).Conn().CopyFrom(ctx, pgx.Identifier{"visits"}, columns, pgx.CopyFromRows(rows))
+			return err
+		})
+	}
+}
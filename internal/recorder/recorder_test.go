@@ -0,0 +1,221 @@
+package recorder
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type collector struct {
+	mu      sync.Mutex
+	batches [][]Visit
+}
+
+func (c *collector) flush(ctx context.Context, visits []Visit) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.batches = append(c.batches, append([]Visit(nil), visits...))
+	return nil
+}
+
+func (c *collector) total() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	total := 0
+	for _, batch := range c.batches {
+		total += len(batch)
+	}
+
+	return total
+}
+
+func TestBatchRecorderFlushesBySize(t *testing.T) {
+	c := &collector{}
+	r := NewBatch(c.flush, Options{BatchSize: 3, FlushInterval: time.Hour, Workers: 1})
+
+	for i := 0; i < 7; i++ {
+		r.Record(Visit{LinkID: int64(i)})
+	}
+
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	sizes := make([]int, 0, len(c.batches))
+	for _, batch := range c.batches {
+		sizes = append(sizes, len(batch))
+	}
+
+	if len(sizes) != 3 || sizes[0] != 3 || sizes[1] != 3 || sizes[2] != 1 {
+		t.Errorf("batch sizes = %v; want [3 3 1]", sizes)
+	}
+
+	if stats := r.Stats(); stats.Enqueued != 7 || stats.Flushed != 7 || stats.Dropped != 0 {
+		t.Errorf("Stats() = %+v; want 7 enqueued and flushed", stats)
+	}
+}
+
+func TestBatchRecorderFlushesByInterval(t *testing.T) {
+	c := &collector{}
+	r := NewBatch(c.flush, Options{BatchSize: 100, FlushInterval: 10 * time.Millisecond, Workers: 1})
+	defer func() {
+		_ = r.Close(context.Background())
+	}()
+
+	r.Record(Visit{LinkID: 1})
+
+	deadline := time.Now().Add(time.Second)
+	for c.total() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if total := c.total(); total != 1 {
+		t.Errorf("flushed %d visits; want 1", total)
+	}
+}
+
+func TestBatchRecorderDropsWhenQueueIsFull(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+
+	flush := func(ctx context.Context, visits []Visit) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+
+	r := NewBatch(flush, Options{QueueSize: 2, BatchSize: 1, Workers: 1})
+
+	// The worker takes the first visit and blocks in flush
+	r.Record(Visit{LinkID: 1})
+	<-started
+
+	for i := 0; i < 4; i++ {
+		r.Record(Visit{LinkID: int64(i + 2)})
+	}
+
+	if stats := r.Stats(); stats.Dropped != 2 || stats.Queued != 2 {
+		t.Errorf("Stats() = %+v; want 2 dropped and 2 queued", stats)
+	}
+
+	go func() {
+		for range started {
+		}
+	}()
+	close(release)
+
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	close(started)
+
+	if stats := r.Stats(); stats.Flushed != 3 {
+		t.Errorf("Stats().Flushed = %d; want 3", stats.Flushed)
+	}
+}
+
+func TestBatchRecorderAfterClose(t *testing.T) {
+	c := &collector{}
+	r := NewBatch(c.flush, Options{})
+
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	r.Record(Visit{LinkID: 1})
+
+	if stats := r.Stats(); stats.Dropped != 1 {
+		t.Errorf("Stats().Dropped = %d; want 1", stats.Dropped)
+	}
+
+	if err := r.Close(context.Background()); !errors.Is(err, ErrorClosed) {
+		t.Errorf("Close() error = %v; want %v", err, ErrorClosed)
+	}
+}
+
+func TestBatchRecorderCountsFailedFlushes(t *testing.T) {
+	flush := func(ctx context.Context, visits []Visit) error {
+		return errors.New("database is down")
+	}
+
+	r := NewBatch(flush, Options{Workers: 1})
+	r.Record(Visit{LinkID: 1})
+	r.Record(Visit{LinkID: 2})
+
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	if stats := r.Stats(); stats.Failed != 2 || stats.Flushed != 0 {
+		t.Errorf("Stats() = %+v; want 2 failed", stats)
+	}
+}
+
+func TestBatchRecorderRetriesTransientErrors(t *testing.T) {
+	c := &collector{}
+	attempts := 0
+
+	flush := func(ctx context.Context, visits []Visit) error {
+		attempts++
+		if attempts == 1 {
+			return &pgconn.PgError{Code: pgerrcode.DeadlockDetected}
+		}
+
+		return c.flush(ctx, visits)
+	}
+
+	r := NewBatch(flush, Options{Workers: 1})
+	r.Record(Visit{LinkID: 1})
+	r.Record(Visit{LinkID: 2})
+
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	if attempts != 2 {
+		t.Errorf("flush attempts = %d; want 2", attempts)
+	}
+
+	if stats := r.Stats(); stats.Flushed != 2 || stats.Failed != 0 {
+		t.Errorf("Stats() = %+v; want 2 flushed", stats)
+	}
+}
+
+func TestBatchRecorderDropsOnlyBadVisits(t *testing.T) {
+	c := &collector{}
+
+	// Like COPY, any deleted link fails the whole batch
+	flush := func(ctx context.Context, visits []Visit) error {
+		for _, visit := range visits {
+			if visit.LinkID == 2 {
+				return &pgconn.PgError{Code: pgerrcode.ForeignKeyViolation}
+			}
+		}
+
+		return c.flush(ctx, visits)
+	}
+
+	r := NewBatch(flush, Options{Workers: 1})
+	for i := 1; i <= 3; i++ {
+		r.Record(Visit{LinkID: int64(i)})
+	}
+
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	if total := c.total(); total != 2 {
+		t.Errorf("flushed %d visits; want 2", total)
+	}
+
+	if stats := r.Stats(); stats.Flushed != 2 || stats.Dropped != 1 || stats.Failed != 0 {
+		t.Errorf("Stats() = %+v; want 2 flushed and 1 dropped", stats)
+	}
+}
@@ -0,0 +1,136 @@
+package retention
+
+import (
+	"context"
+	"log"
+	"time"
+
+	db "github.com/darkartx/go-project-278/db/generated"
+)
+
+const (
+	DefaultBatchSize = 1000
+	DefaultInterval  = time.Hour
+
+	// Pause between batches, lets other writers through
+	batchPause = 100 * time.Millisecond
+)
+
+type Options struct {
+	// Visits older than that are purged, zero keeps them
+	Days int
+	// Links trashed longer than that are purged, zero keeps them
+	TrashDays int
+	BatchSize int32
+	Interval  time.Duration
+}
+
+// Purge deletes visits and visitor rollups created before the time in batches and returns how many visits were deleted
+func Purge(ctx context.Context, queries *db.Queries, before time.Time, batchSize int32) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	total, err := deleteBatches(ctx, batchSize, func(limit int32) (int64, error) {
+		return queries.DeleteVisitsBefore(ctx, db.DeleteVisitsBeforeParams{Before: before, Limit: limit})
+	})
+	if err != nil {
+		return total, err
+	}
+
+	_, err = deleteBatches(ctx, batchSize, func(limit int32) (int64, error) {
+		return queries.DeleteVisitorStatsBefore(ctx, db.DeleteVisitorStatsBeforeParams{Before: before, Limit: limit})
+	})
+
+	return total, err
+}
+
+// PurgeLinks deletes links trashed before the time, with their visits, in batches and returns how many were deleted.
+// Visits and rollups go first in batches of their own, deleting the links would cascade to all of them at once.
+func PurgeLinks(ctx context.Context, queries *db.Queries, before time.Time, batchSize int32) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	_, err := deleteBatches(ctx, batchSize, func(limit int32) (int64, error) {
+		return queries.DeleteTrashedLinkVisitsBefore(ctx, db.DeleteTrashedLinkVisitsBeforeParams{Before: before, Limit: limit})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = deleteBatches(ctx, batchSize, func(limit int32) (int64, error) {
+		return queries.DeleteTrashedLinkStatsBefore(ctx, db.DeleteTrashedLinkStatsBeforeParams{Before: before, Limit: limit})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleteBatches(ctx, batchSize, func(limit int32) (int64, error) {
+		return queries.DeleteTrashedLinksBefore(ctx, db.DeleteTrashedLinksBeforeParams{Before: before, Limit: limit})
+	})
+}
+
+func deleteBatches(ctx context.Context, batchSize int32, deleteBatch func(limit int32) (int64, error)) (int64, error) {
+	var total int64
+
+	for {
+		deleted, err := deleteBatch(batchSize)
+		total += deleted
+
+		if err != nil {
+			return total, err
+		}
+
+		if deleted < int64(batchSize) {
+			return total, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		case <-time.After(batchPause):
+		}
+	}
+}
+
+// Cutoff is the creation time visits older than days are deleted before
+func Cutoff(now time.Time, days int) time.Time {
+	return now.AddDate(0, 0, -days)
+}
+
+// Run purges old visits and trashed links every interval until ctx is done
+func Run(ctx context.Context, queries *db.Queries, options Options) {
+	if options.Interval <= 0 {
+		options.Interval = DefaultInterval
+	}
+
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+
+	for {
+		if options.Days > 0 {
+			deleted, err := Purge(ctx, queries, Cutoff(time.Now(), options.Days), options.BatchSize)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("purge visits: %v", err)
+			} else if deleted > 0 {
+				log.Printf("purged %d visits older than %d days", deleted, options.Days)
+			}
+		}
+
+		if options.TrashDays > 0 {
+			deleted, err := PurgeLinks(ctx, queries, Cutoff(time.Now(), options.TrashDays), options.BatchSize)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("purge links: %v", err)
+			} else if deleted > 0 {
+				log.Printf("purged %d links trashed more than %d days ago", deleted, options.TrashDays)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	db "github.com/darkartx/go-project-278/db/generated"
+)
+
+// table answers the batch deletes of the queries, each query deletes up to its limit from its remaining rows
+type table struct {
+	mu        sync.Mutex
+	remaining map[string]int64
+	errors    map[string]error
+	calls     []string
+	befores   []time.Time
+	onExec    func(name string)
+}
+
+func (t *table) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	name := strings.Fields(query)[2]
+
+	t.mu.Lock()
+	t.calls = append(t.calls, name)
+	t.befores = append(t.befores, args[0].(time.Time))
+
+	deleted := min(t.remaining[name], int64(args[1].(int32)))
+	t.remaining[name] -= deleted
+	err := t.errors[name]
+	onExec := t.onExec
+	t.mu.Unlock()
+
+	if onExec != nil {
+		onExec(name)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(deleted), nil
+}
+
+func (t *table) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (t *table) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func (t *table) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return nil
+}
+
+func (t *table) count(name string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	count := 0
+	for _, call := range t.calls {
+		if call == name {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestPurgeDeletesInBatches(t *testing.T) {
+	rows := &table{remaining: map[string]int64{"DeleteVisitsBefore": 5, "DeleteVisitorStatsBefore": 3}}
+	before := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	deleted, err := Purge(context.Background(), db.New(rows), before, 2)
+	if err != nil {
+		t.Fatalf("Purge() error: %v", err)
+	}
+
+	if deleted != 5 {
+		t.Errorf("Purge() = %d; want 5", deleted)
+	}
+
+	want := []string{"DeleteVisitsBefore", "DeleteVisitsBefore", "DeleteVisitsBefore", "DeleteVisitorStatsBefore", "DeleteVisitorStatsBefore"}
+	if strings.Join(rows.calls, ",") != strings.Join(want, ",") {
+		t.Errorf("queries = %v; want %v", rows.calls, want)
+	}
+
+	for _, actual := range rows.befores {
+		if !actual.Equal(before) {
+			t.Errorf("deleted before %v; want %v", actual, before)
+		}
+	}
+}
+
+func TestPurgeUsesDefaultBatchSize(t *testing.T) {
+	rows := &table{remaining: map[string]int64{"DeleteVisitsBefore": DefaultBatchSize + 1}}
+
+	deleted, err := Purge(context.Background(), db.New(rows), time.Now(), 0)
+	if err != nil {
+		t.Fatalf("Purge() error: %v", err)
+	}
+
+	if deleted != DefaultBatchSize+1 || rows.count("DeleteVisitsBefore") != 2 {
+		t.Errorf("Purge() = %d in %d batches; want %d in 2", deleted, rows.count("DeleteVisitsBefore"), DefaultBatchSize+1)
+	}
+}
+
+func TestPurgeStopsOnError(t *testing.T) {
+	failure := errors.New("connection lost")
+	rows := &table{
+		remaining: map[string]int64{"DeleteVisitsBefore": 5},
+		errors:    map[string]error{"DeleteVisitsBefore": failure},
+	}
+
+	if _, err := Purge(context.Background(), db.New(rows), time.Now(), 2); !errors.Is(err, failure) {
+		t.Errorf("Purge() error = %v; want %v", err, failure)
+	}
+
+	if len(rows.calls) != 1 {
+		t.Errorf("queries = %v; want the failed batch only", rows.calls)
+	}
+}
+
+func TestPurgeStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rows := &table{remaining: map[string]int64{"DeleteVisitsBefore": 10}}
+	rows.onExec = func(string) { cancel() }
+
+	deleted, err := Purge(ctx, db.New(rows), time.Now(), 2)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Purge() error = %v; want %v", err, context.Canceled)
+	}
+
+	if deleted != 2 || len(rows.calls) != 1 {
+		t.Errorf("Purge() = %d in %v; want 2 in one batch", deleted, rows.calls)
+	}
+}
+
+func TestPurgeLinksDeletesVisitsAndRollupsFirst(t *testing.T) {
+	rows := &table{remaining: map[string]int64{
+		"DeleteTrashedLinkVisitsBefore": 3,
+		"DeleteTrashedLinkStatsBefore":  1,
+		"DeleteTrashedLinksBefore":      2,
+	}}
+
+	deleted, err := PurgeLinks(context.Background(), db.New(rows), time.Now(), 2)
+	if err != nil {
+		t.Fatalf("PurgeLinks() error: %v", err)
+	}
+
+	if deleted != 2 {
+		t.Errorf("PurgeLinks() = %d; want the 2 links", deleted)
+	}
+
+	want := []string{
+		"DeleteTrashedLinkVisitsBefore", "DeleteTrashedLinkVisitsBefore",
+		"DeleteTrashedLinkStatsBefore",
+		"DeleteTrashedLinksBefore", "DeleteTrashedLinksBefore",
+	}
+	if strings.Join(rows.calls, ",") != strings.Join(want, ",") {
+		t.Errorf("queries = %v; want %v", rows.calls, want)
+	}
+}
+
+func TestPurgeLinksKeepsLinksWhenVisitsFail(t *testing.T) {
+	failure := errors.New("connection lost")
+	rows := &table{
+		remaining: map[string]int64{"DeleteTrashedLinksBefore": 1},
+		errors:    map[string]error{"DeleteTrashedLinkVisitsBefore": failure},
+	}
+
+	if _, err := PurgeLinks(context.Background(), db.New(rows), time.Now(), 2); !errors.Is(err, failure) {
+		t.Errorf("PurgeLinks() error = %v; want %v", err, failure)
+	}
+
+	if count := rows.count("DeleteTrashedLinksBefore"); count != 0 {
+		t.Errorf("deleted links %d times; want none after the visits failed", count)
+	}
+}
+
+func TestRunPurgesEveryIntervalUntilCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rows := &table{remaining: map[string]int64{}}
+	done := make(chan struct{})
+
+	go func() {
+		Run(ctx, db.New(rows), Options{Days: 30, Interval: 10 * time.Millisecond})
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for rows.count("DeleteVisitsBefore") < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run() didn't return after cancel")
+	}
+
+	if count := rows.count("DeleteVisitsBefore"); count < 2 {
+		t.Errorf("purged visits %d times; want every interval", count)
+	}
+
+	if count := rows.count("DeleteTrashedLinksBefore"); count != 0 {
+		t.Errorf("purged links %d times; want none without TrashDays", count)
+	}
+
+	if cutoff := Cutoff(time.Now(), 30); rows.befores[0].After(cutoff) || rows.befores[0].Before(cutoff.Add(-time.Minute)) {
+		t.Errorf("deleted before %v; want about %v", rows.befores[0], cutoff)
+	}
+}
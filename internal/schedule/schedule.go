@@ -0,0 +1,49 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrorMissingBound  = errors.New("starts_at or ends_at is required")
+	ErrorInvalidWindow = errors.New("ends_at must be after starts_at")
+)
+
+// Entry redirects to its url between StartsAt and EndsAt, a missing bound leaves the window open on that side
+type Entry struct {
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+	Url      string     `json:"url"`
+}
+
+// Validate checks that every entry has a bound and ends after it starts
+func Validate(entries []Entry) error {
+	for i, entry := range entries {
+		if entry.StartsAt == nil && entry.EndsAt == nil {
+			return fmt.Errorf("entry %d: %w", i, ErrorMissingBound)
+		}
+
+		if entry.StartsAt != nil && entry.EndsAt != nil && !entry.StartsAt.Before(*entry.EndsAt) {
+			return fmt.Errorf("entry %d: %w", i, ErrorInvalidWindow)
+		}
+	}
+
+	return nil
+}
+
+func (e Entry) IsActive(now time.Time) bool {
+	return (e.StartsAt == nil || !now.Before(*e.StartsAt)) && (e.EndsAt == nil || now.Before(*e.EndsAt))
+}
+
+// Active returns the first entry active at the time and its index
+func Active(entries []Entry, now time.Time) (int, Entry, bool) {
+	for i, entry := range entries {
+		if entry.IsActive(now) {
+			return i, entry, true
+		}
+	}
+
+	return -1, Entry{}, false
+}
@@ -0,0 +1,64 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	launch = time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	end    = time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func TestActive(t *testing.T) {
+	entries := []Entry{
+		{EndsAt: &launch, Url: "https://example.com/teaser"},
+		{StartsAt: &end, Url: "https://example.com/archive"},
+		{StartsAt: &launch, EndsAt: &end, Url: "https://example.com/overlapped"},
+	}
+
+	tests := []struct {
+		now       time.Time
+		wantIndex int
+		wantUrl   string
+		wantOk    bool
+	}{
+		{launch.Add(-time.Second), 0, "https://example.com/teaser", true},
+		{launch, 2, "https://example.com/overlapped", true},
+		{end.Add(-time.Second), 2, "https://example.com/overlapped", true},
+		{end, 1, "https://example.com/archive", true},
+	}
+
+	for _, tt := range tests {
+		index, entry, ok := Active(entries, tt.now)
+		if index != tt.wantIndex || entry.Url != tt.wantUrl || ok != tt.wantOk {
+			t.Errorf("Active(%v) = %d, %q, %v; want %d, %q, %v", tt.now, index, entry.Url, ok, tt.wantIndex, tt.wantUrl, tt.wantOk)
+		}
+	}
+
+	if _, _, ok := Active(entries[:2], launch); ok {
+		t.Errorf("Active(%v) ok = true; want false between the windows", launch)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		entries []Entry
+		want    error
+	}{
+		{[]Entry{{StartsAt: &launch, EndsAt: &end}}, nil},
+		{[]Entry{{StartsAt: &launch}}, nil},
+		{[]Entry{{EndsAt: &end}}, nil},
+		{nil, nil},
+		{[]Entry{{}}, ErrorMissingBound},
+		{[]Entry{{StartsAt: &end, EndsAt: &launch}}, ErrorInvalidWindow},
+		{[]Entry{{StartsAt: &launch, EndsAt: &launch}}, ErrorInvalidWindow},
+	}
+
+	for _, tt := range tests {
+		if got := Validate(tt.entries); !errors.Is(got, tt.want) {
+			t.Errorf("Validate(%+v) = %v; want %v", tt.entries, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package targeting
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/darkartx/go-project-278/internal/useragent"
+)
+
+// Names of the matched rules, user agent rules are named by their index
+const (
+	TargetIos       = "ios"
+	TargetAndroid   = "android"
+	TargetDesktop   = "desktop"
+	TargetUserAgent = "user_agent"
+	TargetCountry   = "country"
+)
+
+// Rules pick the destination of a link by the visitor, links without a matching rule redirect to the original url
+type Rules struct {
+	// Checked first, in order
+	UserAgents []UserAgentRule `json:"user_agents,omitempty"`
+	Ios        string          `json:"ios,omitempty"`
+	Android    string          `json:"android,omitempty"`
+	Desktop    string          `json:"desktop,omitempty"`
+	// Checked after the device rules, keyed by ISO country code
+	Countries map[string]string `json:"countries,omitempty"`
+}
+
+type UserAgentRule struct {
+	Pattern string `json:"pattern"`
+	Url     string `json:"url"`
+}
+
+type Target struct {
+	Name string
+	Url  string
+}
+
+// Matcher matches visitors against rules with their user agent patterns compiled once
+type Matcher struct {
+	rules    Rules
+	patterns []*regexp.Regexp
+}
+
+// Compile compiles the user agent patterns, reporting the first one that doesn't compile
+func (r Rules) Compile() (Matcher, error) {
+	patterns := make([]*regexp.Regexp, 0, len(r.UserAgents))
+
+	for i, rule := range r.UserAgents {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return Matcher{}, fmt.Errorf("user agent rule %d: %w", i, err)
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return Matcher{rules: r, patterns: patterns}, nil
+}
+
+func (r Rules) Validate() error {
+	_, err := r.Compile()
+	return err
+}
+
+func (r Rules) IsEmpty() bool {
+	return len(r.UserAgents) == 0 && r.Ios == "" && r.Android == "" && r.Desktop == "" && len(r.Countries) == 0
+}
+
+// HasCountries reports whether matching needs the visitor country
+func (r Rules) HasCountries() bool {
+	return len(r.Countries) > 0
+}
+
+func (m Matcher) IsEmpty() bool {
+	return m.rules.IsEmpty()
+}
+
+func (m Matcher) HasCountries() bool {
+	return m.rules.HasCountries()
+}
+
+// Match returns the first rule matching the user agent and country, bots only match user agent rules
+func (m Matcher) Match(userAgent string, country string) (Target, bool) {
+	r := m.rules
+
+	for i, pattern := range m.patterns {
+		if pattern.MatchString(userAgent) {
+			return Target{Name: fmt.Sprintf("%s:%d", TargetUserAgent, i), Url: r.UserAgents[i].Url}, true
+		}
+	}
+
+	parsed := useragent.Parse(userAgent)
+
+	switch {
+	case parsed.Device == useragent.DeviceBot:
+		return Target{}, false
+	case parsed.Os == useragent.OsIos && r.Ios != "":
+		return Target{Name: TargetIos, Url: r.Ios}, true
+	case parsed.Os == useragent.OsAndroid && r.Android != "":
+		return Target{Name: TargetAndroid, Url: r.Android}, true
+	case parsed.Device == useragent.DeviceDesktop && r.Desktop != "":
+		return Target{Name: TargetDesktop, Url: r.Desktop}, true
+	}
+
+	if url, ok := r.Countries[strings.ToUpper(country)]; ok && country != "" {
+		return Target{Name: TargetCountry + ":" + strings.ToUpper(country), Url: url}, true
+	}
+
+	return Target{}, false
+}
@@ -0,0 +1,67 @@
+package targeting
+
+import "testing"
+
+const (
+	iphone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"
+	ipad    = "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1"
+	android = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36"
+	windows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:124.0) Gecko/20100101 Firefox/124.0"
+	bot     = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+)
+
+func TestMatch(t *testing.T) {
+	rules := Rules{
+		UserAgents: []UserAgentRule{{Pattern: `Pixel \d+`, Url: "https://pixel.example.com"}},
+		Ios:        "https://apps.apple.com/app/id1",
+		Android:    "https://play.google.com/store/apps/details?id=app",
+		Desktop:    "https://example.com",
+	}
+
+	countries := Rules{Countries: map[string]string{"DE": "https://example.de", "GB": "https://example.co.uk"}}
+
+	tests := []struct {
+		rules     Rules
+		userAgent string
+		country   string
+		want      Target
+		wantOk    bool
+	}{
+		{rules, iphone, "", Target{TargetIos, rules.Ios}, true},
+		{rules, ipad, "", Target{TargetIos, rules.Ios}, true},
+		{rules, android, "", Target{"user_agent:0", "https://pixel.example.com"}, true},
+		{Rules{Android: rules.Android}, android, "", Target{TargetAndroid, rules.Android}, true},
+		{rules, windows, "", Target{TargetDesktop, rules.Desktop}, true},
+		{rules, windows, "DE", Target{TargetDesktop, rules.Desktop}, true},
+		{rules, bot, "", Target{}, false},
+		{rules, "", "", Target{}, false},
+		{Rules{Ios: rules.Ios}, windows, "", Target{}, false},
+		{countries, windows, "DE", Target{"country:DE", "https://example.de"}, true},
+		{countries, iphone, "de", Target{"country:DE", "https://example.de"}, true},
+		{countries, windows, "FR", Target{}, false},
+		{countries, windows, "", Target{}, false},
+		{countries, bot, "DE", Target{}, false},
+	}
+
+	for _, tt := range tests {
+		matcher, err := tt.rules.Compile()
+		if err != nil {
+			t.Fatalf("Compile() error = %v", err)
+		}
+
+		got, ok := matcher.Match(tt.userAgent, tt.country)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("Match(%q, %q) = %+v, %v; want %+v, %v", tt.userAgent, tt.country, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Rules{UserAgents: []UserAgentRule{{Pattern: `^Mozilla`}}}).Validate(); err != nil {
+		t.Errorf("Validate() error = %v; want nil", err)
+	}
+
+	if err := (Rules{UserAgents: []UserAgentRule{{Pattern: `(`}}}).Validate(); err == nil {
+		t.Errorf("Validate() error = nil; want error")
+	}
+}
@@ -0,0 +1,52 @@
+// Package throttle limits attempts per key, like passwords tried on a link from one address
+package throttle
+
+import (
+	"sync"
+	"time"
+
+	"github.com/darkartx/go-project-278/internal/cache"
+)
+
+type attempts struct {
+	count int
+	last  time.Time
+}
+
+// Limiter blocks a key after max attempts until window has passed since the last one.
+// Keys are kept in memory, the least recently tried are forgotten past capacity.
+type Limiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	attempts *cache.LRU[string, attempts]
+}
+
+func New(max int, window time.Duration, capacity int) *Limiter {
+	return &Limiter{
+		max:      max,
+		window:   window,
+		attempts: cache.New[string, attempts](capacity, window),
+	}
+}
+
+// Attempt counts an attempt of the key if it may try, otherwise reports how long it has to wait.
+// Checking and counting in one step keeps concurrent attempts from passing the limit together.
+func (l *Limiter) Attempt(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	current, _ := l.attempts.Get(key)
+	if current.count >= l.max {
+		return max(time.Until(current.last.Add(l.window)), 0), false
+	}
+
+	l.attempts.Set(key, attempts{count: current.count + 1, last: time.Now()})
+
+	return 0, true
+}
+
+// Reset forgets the attempts of the key after a successful one
+func (l *Limiter) Reset(key string) {
+	l.attempts.Remove(key)
+}
@@ -0,0 +1,71 @@
+package throttle
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiterBlocksAfterMaxAttempts(t *testing.T) {
+	l := New(2, time.Minute, 10)
+
+	for i := 0; i < 2; i++ {
+		if _, ok := l.Attempt("a"); !ok {
+			t.Fatalf("Attempt(a) = false after %d attempts; want true", i)
+		}
+	}
+
+	wait, ok := l.Attempt("a")
+	if ok || wait <= 0 || wait > time.Minute {
+		t.Errorf("Attempt(a) = %v, %v; want blocked for up to a minute", wait, ok)
+	}
+
+	if _, ok := l.Attempt("b"); !ok {
+		t.Errorf("Attempt(b) = false; want other keys allowed")
+	}
+
+	l.Reset("a")
+	if _, ok := l.Attempt("a"); !ok {
+		t.Errorf("Attempt(a) = false after Reset; want true")
+	}
+}
+
+func TestLimiterConcurrentAttempts(t *testing.T) {
+	l := New(5, time.Minute, 10)
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, ok := l.Attempt("a"); ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if got := allowed.Load(); got != 5 {
+		t.Errorf("allowed %d concurrent attempts; want 5", got)
+	}
+}
+
+func TestLimiterForgetsAttemptsAfterWindow(t *testing.T) {
+	l := New(1, 20*time.Millisecond, 10)
+
+	l.Attempt("a")
+	if _, ok := l.Attempt("a"); ok {
+		t.Fatalf("Attempt(a) = true; want blocked")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if _, ok := l.Attempt("a"); !ok {
+		t.Errorf("Attempt(a) = false after the window; want true")
+	}
+}
@@ -0,0 +1,156 @@
+package useragent
+
+import (
+	"strings"
+
+	"github.com/darkartx/go-project-278/internal/visitor"
+)
+
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+
+	OsIos     = "iOS"
+	OsAndroid = "Android"
+
+	Other = "Other"
+)
+
+type UserAgent struct {
+	Browser        string
+	BrowserVersion string
+	Os             string
+	OsVersion      string
+	Device         string
+}
+
+type rule struct {
+	name   string
+	tokens []string
+}
+
+// Checked in order, browsers built on Chrome and Safari mention them too, so they go first
+var browserRules = []rule{
+	{"Edge", []string{"Edg/", "Edge/", "EdgA/", "EdgiOS/"}},
+	{"Opera", []string{"OPR/", "OPiOS/", "Opera/"}},
+	{"Samsung Internet", []string{"SamsungBrowser/"}},
+	{"Yandex Browser", []string{"YaBrowser/"}},
+	{"Vivaldi", []string{"Vivaldi/"}},
+	{"Firefox", []string{"Firefox/", "FxiOS/"}},
+	{"Chromium", []string{"Chromium/"}},
+	{"Chrome", []string{"Chrome/", "CriOS/"}},
+	{"Internet Explorer", []string{"MSIE ", "Trident/"}},
+	{"Safari", []string{"Version/"}},
+}
+
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.1":  "XP",
+}
+
+// Parse extracts browser, os and device type from the user agent, unknown parts stay empty
+func Parse(userAgent string) UserAgent {
+	if strings.TrimSpace(userAgent) == "" {
+		return UserAgent{}
+	}
+
+	var result UserAgent
+
+	result.Browser, result.BrowserVersion = parseBrowser(userAgent)
+	result.Os, result.OsVersion = parseOs(userAgent)
+	result.Device = parseDevice(userAgent)
+
+	return result
+}
+
+func parseBrowser(userAgent string) (string, string) {
+	for _, rule := range browserRules {
+		for _, token := range rule.tokens {
+			if !strings.Contains(userAgent, token) {
+				continue
+			}
+
+			// Safari reports its own version in Version/, everything else after the token
+			if rule.name == "Safari" && !strings.Contains(userAgent, "Safari/") {
+				continue
+			}
+
+			if token == "Trident/" {
+				return rule.name, versionAfter(userAgent, "rv:")
+			}
+
+			return rule.name, versionAfter(userAgent, token)
+		}
+	}
+
+	return Other, ""
+}
+
+func parseOs(userAgent string) (string, string) {
+	switch {
+	case strings.Contains(userAgent, "Windows Phone"):
+		return "Windows Phone", versionAfter(userAgent, "Windows Phone ")
+	case strings.Contains(userAgent, "Windows NT "):
+		version := versionAfter(userAgent, "Windows NT ")
+		if name, ok := windowsVersions[version]; ok {
+			version = name
+		}
+
+		return "Windows", version
+	case strings.Contains(userAgent, "iPhone OS "):
+		return OsIos, versionAfter(userAgent, "iPhone OS ")
+	case strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "iPod"):
+		return OsIos, versionAfter(userAgent, "CPU OS ")
+	case strings.Contains(userAgent, "Android"):
+		return OsAndroid, versionAfter(userAgent, "Android ")
+	case strings.Contains(userAgent, "CrOS"):
+		return "Chrome OS", ""
+	case strings.Contains(userAgent, "Mac OS X"):
+		return "macOS", versionAfter(userAgent, "Mac OS X ")
+	case strings.Contains(userAgent, "Linux"):
+		return "Linux", ""
+	}
+
+	return Other, ""
+}
+
+func parseDevice(userAgent string) string {
+	if visitor.Classify(userAgent) == visitor.Bot {
+		return DeviceBot
+	}
+
+	switch {
+	case strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "Tablet"):
+		return DeviceTablet
+	case strings.Contains(userAgent, "Android") && !strings.Contains(userAgent, "Mobile"):
+		return DeviceTablet
+	case strings.Contains(userAgent, "Mobi") || strings.Contains(userAgent, "iPhone") ||
+		strings.Contains(userAgent, "iPod") || strings.Contains(userAgent, "Windows Phone"):
+		return DeviceMobile
+	}
+
+	return DeviceDesktop
+}
+
+// Reads the dotted version right after token, underscores are used as dots by Apple
+func versionAfter(userAgent string, token string) string {
+	index := strings.Index(userAgent, token)
+	if index < 0 {
+		return ""
+	}
+
+	rest := userAgent[index+len(token):]
+	end := 0
+
+	for end < len(rest) && (rest[end] >= '0' && rest[end] <= '9' || rest[end] == '.' || rest[end] == '_') {
+		end++
+	}
+
+	return strings.Trim(strings.ReplaceAll(rest[:end], "_", "."), ".")
+}
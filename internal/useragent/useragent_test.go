@@ -0,0 +1,66 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      UserAgent
+	}{
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:124.0) Gecko/20100101 Firefox/124.0",
+			UserAgent{"Firefox", "124.0", "Windows", "10", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			UserAgent{"Chrome", "124.0.0.0", "Windows", "10", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51",
+			UserAgent{"Edge", "124.0.2478.51", "Windows", "10", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+			UserAgent{"Safari", "17.4", "macOS", "10.15.7", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			UserAgent{"Safari", "17.4", "iOS", "17.4", DeviceMobile},
+		},
+		{
+			"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1",
+			UserAgent{"Chrome", "120.0.6099.119", "iOS", "16.6", DeviceTablet},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+			UserAgent{"Chrome", "124.0.0.0", "Android", "14", DeviceMobile},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Safari/537.36",
+			UserAgent{"Samsung Internet", "23.0", "Android", "13", DeviceTablet},
+		},
+		{
+			"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 OPR/109.0.0.0",
+			UserAgent{"Opera", "109.0.0.0", "Linux", "", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko",
+			UserAgent{"Internet Explorer", "11.0", "Windows", "7", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			UserAgent{"Other", "", "Other", "", DeviceBot},
+		},
+		{
+			"curl/8.4.0",
+			UserAgent{"Other", "", "Other", "", DeviceDesktop},
+		},
+		{"", UserAgent{}},
+	}
+
+	for _, tt := range tests {
+		if got := Parse(tt.userAgent); got != tt.want {
+			t.Errorf("Parse(%q) = %+v; want %+v", tt.userAgent, got, tt.want)
+		}
+	}
+}
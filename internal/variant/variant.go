@@ -0,0 +1,77 @@
+package variant
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+)
+
+var ErrorDuplicateName = errors.New("duplicate variant name")
+
+// Variant is one of the destinations a link rotates between, picked in proportion to its weight
+type Variant struct {
+	Name   string `json:"name"`
+	Url    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// Validate checks that names are unique, visits are told apart by them
+func Validate(variants []Variant) error {
+	names := make(map[string]struct{}, len(variants))
+
+	for _, variant := range variants {
+		if _, exists := names[variant.Name]; exists {
+			return fmt.Errorf("%w %q", ErrorDuplicateName, variant.Name)
+		}
+
+		names[variant.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+func TotalWeight(variants []Variant) int {
+	total := 0
+	for _, variant := range variants {
+		total += max(variant.Weight, 0)
+	}
+
+	return total
+}
+
+// Pick returns the variant the roll falls on, roll is in [0, TotalWeight)
+func Pick(variants []Variant, roll int) (Variant, bool) {
+	for _, variant := range variants {
+		if variant.Weight <= 0 {
+			continue
+		}
+
+		if roll < variant.Weight {
+			return variant, true
+		}
+
+		roll -= variant.Weight
+	}
+
+	return Variant{}, false
+}
+
+// Choose picks a random variant by weight
+func Choose(variants []Variant) (Variant, bool) {
+	total := TotalWeight(variants)
+	if total == 0 {
+		return Variant{}, false
+	}
+
+	return Pick(variants, rand.IntN(total))
+}
+
+func Find(variants []Variant, name string) (Variant, bool) {
+	for _, variant := range variants {
+		if variant.Name == name && variant.Weight > 0 {
+			return variant, true
+		}
+	}
+
+	return Variant{}, false
+}
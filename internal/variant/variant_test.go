@@ -0,0 +1,77 @@
+package variant
+
+import (
+	"errors"
+	"testing"
+)
+
+var variants = []Variant{
+	{"a", "https://example.com/a", 1},
+	{"off", "https://example.com/off", 0},
+	{"b", "https://example.com/b", 3},
+}
+
+func TestPick(t *testing.T) {
+	tests := []struct {
+		roll   int
+		want   string
+		wantOk bool
+	}{
+		{0, "a", true},
+		{1, "b", true},
+		{3, "b", true},
+		{4, "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := Pick(variants, tt.roll)
+		if got.Name != tt.want || ok != tt.wantOk {
+			t.Errorf("Pick(%d) = %+v, %v; want %q, %v", tt.roll, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestChoose(t *testing.T) {
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		got, ok := Choose(variants)
+		if !ok {
+			t.Fatalf("Choose() ok = false")
+		}
+
+		counts[got.Name]++
+	}
+
+	if counts["off"] != 0 || counts["a"] < 700 || counts["a"] > 1300 {
+		t.Errorf("Choose() counts = %v; want about 1000 a, 3000 b", counts)
+	}
+
+	if _, ok := Choose(nil); ok {
+		t.Errorf("Choose(nil) ok = true; want false")
+	}
+}
+
+func TestFind(t *testing.T) {
+	if got, ok := Find(variants, "b"); !ok || got.Url != "https://example.com/b" {
+		t.Errorf("Find(b) = %+v, %v", got, ok)
+	}
+
+	// Switched off variants aren't served to returning visitors either
+	if _, ok := Find(variants, "off"); ok {
+		t.Errorf("Find(off) ok = true; want false")
+	}
+
+	if _, ok := Find(variants, "c"); ok {
+		t.Errorf("Find(c) ok = true; want false")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(variants); err != nil {
+		t.Errorf("Validate() error = %v; want nil", err)
+	}
+
+	if err := Validate([]Variant{{Name: "a"}, {Name: "a"}}); !errors.Is(err, ErrorDuplicateName) {
+		t.Errorf("Validate() error = %v; want %v", err, ErrorDuplicateName)
+	}
+}
@@ -0,0 +1,85 @@
+package visitor
+
+import "strings"
+
+const (
+	Human      = "human"
+	Bot        = "bot"
+	Suspicious = "suspicious"
+)
+
+// Crawlers and link preview fetchers that announce themselves, matched case insensitively
+var botTokens = []string{
+	"slackbot",
+	"slack-imgproxy",
+	"twitterbot",
+	"googlebot",
+	"google-inspectiontool",
+	"adsbot-google",
+	"bingbot",
+	"yandexbot",
+	"duckduckbot",
+	"baiduspider",
+	"applebot",
+	"facebookexternalhit",
+	"facebookcatalog",
+	"linkedinbot",
+	"discordbot",
+	"telegrambot",
+	"whatsapp",
+	"skypeuripreview",
+	"pinterestbot",
+	"redditbot",
+	"embedly",
+	"iframely",
+	"vkshare",
+	"mastodon",
+	"bot",
+	"crawler",
+	"spider",
+	"preview",
+}
+
+// Http libraries and headless browsers, real users don't click links with them
+var suspiciousTokens = []string{
+	"curl",
+	"wget",
+	"python",
+	"go-http-client",
+	"java/",
+	"okhttp",
+	"axios",
+	"node-fetch",
+	"libwww-perl",
+	"scrapy",
+	"httpclient",
+	"headlesschrome",
+	"phantomjs",
+}
+
+// Classify tells human visits from bots by the user agent
+func Classify(userAgent string) string {
+	userAgent = strings.ToLower(strings.TrimSpace(userAgent))
+
+	if userAgent == "" {
+		return Suspicious
+	}
+
+	for _, token := range botTokens {
+		if strings.Contains(userAgent, token) {
+			return Bot
+		}
+	}
+
+	for _, token := range suspiciousTokens {
+		if strings.Contains(userAgent, token) {
+			return Suspicious
+		}
+	}
+
+	if !strings.HasPrefix(userAgent, "mozilla/") && !strings.HasPrefix(userAgent, "opera/") {
+		return Suspicious
+	}
+
+	return Human
+}
@@ -0,0 +1,32 @@
+package visitor
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		userAgent, want string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:124.0) Gecko/20100101 Firefox/124.0", Human},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1", Human},
+		{"Opera/9.80 (Windows NT 6.1; U; en) Presto/2.10.289 Version/12.00", Human},
+		{"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", Bot},
+		{"Twitterbot/1.0", Bot},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", Bot},
+		{"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", Bot},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 11_6) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.0 Safari/605.1.15 (Applebot/0.1)", Bot},
+		{"WhatsApp/2.23.20.0", Bot},
+		{"TelegramBot (like TwitterBot)", Bot},
+		{"", Suspicious},
+		{"curl/8.4.0", Suspicious},
+		{"python-requests/2.31.0", Suspicious},
+		{"Go-http-client/1.1", Suspicious},
+		{"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36", Suspicious},
+		{"UserAgent", Suspicious},
+	}
+
+	for _, tt := range tests {
+		if got := Classify(tt.userAgent); got != tt.want {
+			t.Errorf("Classify(%q) = %s; want %s", tt.userAgent, got, tt.want)
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
+	"github.com/darkartx/go-project-278/handlers"
 	"github.com/joho/godotenv"
 )
 
@@ -20,7 +22,7 @@ func main() {
 		return
 	}
 
-	err = Api(&config)
+	err = runCommand(&config, os.Args[1:])
 
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -29,9 +31,13 @@ func main() {
 
 func getConfigFromEnv() (Config, error) {
 	result := Config{
-		Debug:       false,
-		DatabaseUrl: "",
-		Bind:        "0.0.0.0:8080",
+		Debug:         false,
+		DatabaseUrl:   "",
+		Bind:          "0.0.0.0:8080",
+		LinkCacheSize: 10000,
+		LinkCacheTTL:  time.Minute,
+		RedirectType:  handlers.DefaultRedirectType,
+		LinkTrashDays: 30,
 	}
 
 	if debugEnv, exists := os.LookupEnv("DEBUG"); exists {
@@ -55,6 +61,57 @@ func getConfigFromEnv() (Config, error) {
 		result.Bind = bind
 	}
 
+	for name, value := range map[string]*int{
+		"VISITS_QUEUE_SIZE":    &result.Visits.QueueSize,
+		"VISITS_BATCH_SIZE":    &result.Visits.BatchSize,
+		"VISITS_WORKERS":       &result.Visits.Workers,
+		"LINK_CACHE_SIZE":      &result.LinkCacheSize,
+		"VISIT_RETENTION_DAYS": &result.VisitRetentionDays,
+		"REDIRECT_TYPE":        &result.RedirectType,
+		"LINK_TRASH_DAYS":      &result.LinkTrashDays,
+	} {
+		// An empty value, as in .env.example, keeps the default
+		if env, exists := os.LookupEnv(name); exists && env != "" {
+			parsed, err := strconv.Atoi(env)
+			if err != nil {
+				return Config{}, fmt.Errorf("%s: %w", name, err)
+			}
+
+			*value = parsed
+		}
+	}
+
+	if !handlers.IsRedirectType(result.RedirectType) {
+		return Config{}, fmt.Errorf("REDIRECT_TYPE: %d is not one of 301, 302, 307 or 308", result.RedirectType)
+	}
+
+	if flushInterval, exists := os.LookupEnv("VISITS_FLUSH_INTERVAL"); exists {
+		interval, err := time.ParseDuration(flushInterval)
+		if err != nil {
+			return Config{}, fmt.Errorf("VISITS_FLUSH_INTERVAL: %w", err)
+		}
+
+		result.Visits.FlushInterval = interval
+	}
+
+	if geoipDatabase, exists := os.LookupEnv("GEOIP_DATABASE"); exists {
+		result.GeoipDatabase = geoipDatabase
+	}
+
+	result.Privacy.IpMode = os.Getenv("PRIVACY_IP_MODE")
+	result.Privacy.DntMode = os.Getenv("PRIVACY_DNT")
+	result.Privacy.RefererMode = os.Getenv("PRIVACY_REFERER")
+	result.Privacy.Salt = os.Getenv("PRIVACY_IP_SALT")
+
+	if cacheTTL, exists := os.LookupEnv("LINK_CACHE_TTL"); exists {
+		ttl, err := time.ParseDuration(cacheTTL)
+		if err != nil {
+			return Config{}, fmt.Errorf("LINK_CACHE_TTL: %w", err)
+		}
+
+		result.LinkCacheTTL = ttl
+	}
+
 	return result, nil
 }
 